@@ -19,86 +19,312 @@ package assembler
 
 import (
 	"bufio"
-	"fmt"
+	"errors"
+	"go-AVM/avm"
 	"go-AVM/avm/binary"
 	"io"
-	"log"
-	"os"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-var opcodes = make(map[string]byte, 256)
+// instructions maps the name of every instruction of the AVM to its
+// description.
+var instructions = make(map[string]avm.InstructionInfo, 256)
 
-const OpcodesFile = "../opcodes.txt"
+// operandFormats contains the formats of the immediate operands of every
+// instruction.
+var operandFormats = make(map[string][]operandFormat, 256)
+
+// branchFamilies contains the generic mnemonics of branch instructions, like
+// `jmpEq`, which have both a 16-bit and a 32-bit offset version.
+var branchFamilies = make(map[string]bool)
+
+var labelRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 
 func init() {
-	f, err := os.Open(OpcodesFile)
-	if err != nil {
-		log.Fatal(err)
+	for _, info := range avm.Instructions() {
+		instructions[info.Name] = info
+		operandFormats[info.Name] = parseOperandFormats(info.Operands)
 	}
-	defer func(f *os.File) {
-		if e := f.Close(); e != nil {
-			log.Fatal(e)
+	for name, info := range instructions {
+		if stem := strings.TrimSuffix(name, "C16"); info.Operands == "o16" && stem != name {
+			if wide, ok := instructions[stem+"C32"]; ok && wide.Operands == "o32" {
+				branchFamilies[stem] = true
+			}
 		}
-	}(f)
-
-	var (
-		opcode      byte
-		instruction string
-	)
-	for {
-		_, err := fmt.Fscanln(f, &opcode, &instruction)
-		if err == io.EOF {
-			return
+	}
+}
+
+// Assemble assembles a program. Immediate operands follow their instruction
+// and must match its operand formats (see avm.InstructionInfo). An operand
+// is an integer, like `12`, `-3` or `0x1f`, or a sized constant, like
+// `2d-12`, whose size in bytes must be the size of the operand.
+//
+// A token ending with a colon, like `loop:`, defines a label, and branch
+// offsets, including the offsets of jmpTable, can be written as labels:
+//
+//		loop: pushC64 1 iSub dup jmpNzC16 loop
+//
+// A generic branch mnemonic, like `jmpNz` or `jmp`, can be used with labels.
+// The assembler uses the 16-bit version of a generic branch when the target is
+// in range, and the 32-bit version otherwise.
+//
+// If the program has errors, the returned error is an ErrorList which
+// contains all the problems of the program.
+func Assemble(r io.Reader) ([]byte, error) {
+	return assemble(r)
+}
+
+// AssembleString is like Assemble but reads the program from a string.
+func AssembleString(program string) ([]byte, error) {
+	return assemble(strings.NewReader(program))
+}
+
+// MustAssembleString is like AssembleString but panics if the program has
+// errors. It is intended for tests.
+func MustAssembleString(program string) []byte {
+	bytecode, err := AssembleString(program)
+	if err != nil {
+		panic(err)
+	}
+	return bytecode
+}
+
+// item is an encoded instruction. The offsets of label references are
+// filled after the addresses of labels are known.
+type item struct {
+	name  string
+	bytes []byte
+	refs  []labelRef
+	// generic is the mnemonic of a generic branch, which can be widened by
+	// the assembler
+	generic string
+}
+
+// labelRef is a label used as a branch offset. The offset is relative to
+// the end of the instruction.
+type labelRef struct {
+	target token
+	// position and size of the offset in the encoded instruction
+	position int
+	size     int
+}
+
+type token struct {
+	text         string
+	line, column int
+}
+
+// scanTokens splits the program into white space separated tokens. A `#`
+// starts a comment which ends at the end of the line.
+func scanTokens(r io.Reader) ([]token, error) {
+	var tokens []token
+	lineScanner := bufio.NewScanner(r)
+	// programs are often written in a single line
+	lineScanner.Buffer(nil, math.MaxInt32)
+	for line := 1; lineScanner.Scan(); line++ {
+		text := lineScanner.Text()
+		if c := strings.IndexByte(text, '#'); c >= 0 {
+			text = text[:c]
 		}
-		if err != nil {
-			panic(err)
+		for i := 0; i < len(text); {
+			if unicode.IsSpace(rune(text[i])) {
+				i++
+				continue
+			}
+			j := i
+			for j < len(text) && !unicode.IsSpace(rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, token{text: text[i:j], line: line, column: i + 1})
+			i = j
 		}
-		opcodes[instruction] = opcode
 	}
+	return tokens, lineScanner.Err()
 }
 
-func AssembleFile() {
+func assemble(r io.Reader) ([]byte, error) {
+	tokens, err := scanTokens(r)
+	if err != nil {
+		return nil, err
+	}
+	var errs ErrorList
+	bytecode := assembleTokens(tokens, &errs)
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
 }
 
-func AssembleString(program string) []byte {
-	return assemble(strings.NewReader(program))
+// assembleTokens assembles a single method. All the problems of the method
+// are added to errs.
+func assembleTokens(tokens []token, errs *ErrorList) []byte {
+	var items []item
+	// labels maps every label to the index of the item that follows it
+	labels := make(map[string]int)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if name := strings.TrimSuffix(t.text, ":"); name != t.text {
+			if !isLabel(name) {
+				errs.add(t, "invalid label")
+			} else if _, exists := labels[name]; exists {
+				errs.add(t, "duplicate label")
+			} else {
+				labels[name] = len(items)
+			}
+			continue
+		}
+		if branchFamilies[t.text] {
+			if i+1 == len(tokens) || startsStatement(tokens[i+1].text) {
+				errs.add(t, "missing operand")
+				continue
+			}
+			i++
+			if !isLabel(tokens[i].text) {
+				errs.add(tokens[i], "generic branch needs a label operand")
+				continue
+			}
+			items = append(items, item{
+				name:    t.text + "C16",
+				bytes:   []byte{byte(instructions[t.text+"C16"].Opcode), 0, 0},
+				refs:    []labelRef{{target: tokens[i], position: 1, size: 2}},
+				generic: t.text,
+			})
+			continue
+		}
+		if _, ok := instructions[t.text]; !ok {
+			if isConstant(t.text) {
+				errs.add(t, "unexpected operand")
+			} else {
+				errs.add(t, "unknown instruction")
+			}
+			continue
+		}
+		it, consumed := parseInstruction(tokens[i:], errs)
+		i += consumed
+		if it != nil {
+			items = append(items, *it)
+		}
+	}
+	return link(items, labels, errs)
 }
 
-func assemble(r io.Reader) (bytecode []byte) {
-	wordScanner := bufio.NewScanner(r)
-	wordScanner.Split(bufio.ScanWords)
-	for wordScanner.Scan() {
-		token := wordScanner.Text()
-		v, err := strconv.ParseInt(token, 0, 64)
-		if err == nil {
+// parseInstruction encodes the instruction at tokens[0] and its immediate
+// operands. It returns the number of consumed operand tokens. When the
+// instruction has errors the returned item is nil.
+func parseInstruction(tokens []token, errs *ErrorList) (*item, int) {
+	name := tokens[0].text
+	it := &item{name: name, bytes: []byte{byte(instructions[name].Opcode)}}
+	consumed := 0
+	// count is the value of the first operand, which is the number of
+	// repetitions of a repeated operand
+	var count uint64
+	for k, f := range operandFormats[name] {
+		n := uint64(1)
+		if f.repeated {
+			n = count
+		}
+		for ; n > 0; n-- {
+			if consumed+1 == len(tokens) || startsStatement(tokens[consumed+1].text) {
+				errs.add(tokens[0], "missing operand")
+				return nil, consumed
+			}
+			consumed++
+			t := tokens[consumed]
+			if f.kind == 'o' && isLabel(t.text) {
+				it.refs = append(it.refs, labelRef{target: t, position: len(it.bytes), size: f.size})
+				it.bytes = append(it.bytes, make([]byte, f.size)...)
+				continue
+			}
+			v, msg := parseOperand(t.text, f)
+			if msg != "" {
+				errs.add(t, msg)
+				return nil, consumed
+			}
+			if k == 0 {
+				count = v
+			}
 			b := make([]byte, 8)
-			binary.PutInt64(b, 0, v)
-			bytecode = append(bytecode, b...)
-		} else if matched, _ := regexp.MatchString("[1-8][d][0-9|-]", token); matched {
-			parts := strings.Split(token, "d")
-			v, err = strconv.ParseInt(parts[1], 10, 64)
-			if err != nil {
-				log.Fatal(err)
+			binary.PutInt64(b, 0, int64(v))
+			it.bytes = append(it.bytes, b[:f.size]...)
+		}
+	}
+	return it, consumed
+}
+
+// isConstant reports whether the token looks like a constant operand.
+func isConstant(token string) bool {
+	_, err := strconv.ParseInt(token, 0, 64)
+	return err == nil || errors.Is(err, strconv.ErrRange) || sizedConstant.MatchString(token)
+}
+
+// startsStatement reports whether the token is an instruction or a label
+// definition.
+func startsStatement(token string) bool {
+	_, isInstruction := instructions[token]
+	return isInstruction || branchFamilies[token] || strings.HasSuffix(token, ":")
+}
+
+func isLabel(token string) bool {
+	_, isInstruction := instructions[token]
+	return labelRegexp.MatchString(token) && !isInstruction && !branchFamilies[token]
+}
+
+// link resolves the labels and fills the offsets of label references.
+// Generic branches start with a 16-bit offset and are widened until every
+// offset fits. Since branches only grow, this always terminates.
+func link(items []item, labels map[string]int, errs *ErrorList) []byte {
+	var undefined []string
+	for _, it := range items {
+		for _, ref := range it.refs {
+			if _, ok := labels[ref.target.text]; !ok {
+				errs.add(ref.target, "undefined label")
+				undefined = append(undefined, ref.target.text)
 			}
-			bytes, _ := strconv.Atoi(parts[0])
+		}
+	}
+	// undefined labels are linked to the beginning of the program, so the
+	// rest of the program can still be checked
+	for _, name := range undefined {
+		labels[name] = 0
+	}
 
-			b := make([]byte, 8)
-			binary.PutInt64(b, 0, v)
-			bytecode = append(bytecode, b[:bytes]...)
-		} else {
-			opcode, ok := opcodes[token]
-			if !ok {
-				log.Fatal("unknown instruction: " + token)
+	addresses := make([]int64, len(items)+1)
+	for changed := true; changed; {
+		changed = false
+		for i := range items {
+			addresses[i+1] = addresses[i] + int64(len(items[i].bytes))
+		}
+		for i := range items {
+			it := &items[i]
+			if it.generic == "" || it.refs[0].size == 4 {
+				continue
+			}
+			if offset := addresses[labels[it.refs[0].target.text]] - addresses[i+1]; !fitsSigned(offset, 2) {
+				it.name = it.generic + "C32"
+				it.bytes = []byte{byte(instructions[it.name].Opcode), 0, 0, 0, 0}
+				it.refs[0].size = 4
+				changed = true
 			}
-			bytecode = append(bytecode, opcode)
 		}
 	}
 
-	if err := wordScanner.Err(); err != nil {
-		log.Fatal(err)
+	var bytecode []byte
+	for i, it := range items {
+		for _, ref := range it.refs {
+			offset := addresses[labels[ref.target.text]] - addresses[i+1]
+			if !fitsSigned(offset, ref.size) {
+				errs.add(ref.target, "branch target out of range for "+it.name)
+				continue
+			}
+			b := make([]byte, 8)
+			binary.PutInt64(b, 0, offset)
+			copy(it.bytes[ref.position:], b[:ref.size])
+		}
+		bytecode = append(bytecode, it.bytes...)
 	}
 	return bytecode
 }
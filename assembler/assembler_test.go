@@ -18,7 +18,11 @@
 package assembler
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-AVM/avm"
+	"strings"
 	"testing"
 )
 
@@ -28,11 +32,6 @@ func TestAssembleString1(t *testing.T) {
 		program string
 		want    []byte
 	}{
-		{
-			name:    "1 byte positive",
-			program: "pushC64 1d23 ret64",
-			want:    []byte{0x10, 0x17, 0x9},
-		},
 		{
 			name:    "normal positive",
 			program: "pushC64 23 ret64",
@@ -44,35 +43,210 @@ func TestAssembleString1(t *testing.T) {
 			want:    []byte{0x10, 0xd3, 0xd2, 0xd1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x9},
 		},
 		{
-			name:    "2 byte positive",
-			program: "pushC64 2d23 ret64",
-			want:    []byte{0x10, 0x17, 0x0, 0x9},
+			name:    "sized",
+			program: "pushC64 8d-2 ret64",
+			want:    []byte{0x10, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x9},
 		},
 		{
-			name:    "2 byte positive big",
-			program: "pushC64 2d65535 ret64",
-			want:    []byte{0x10, 0xff, 0xff, 0x9},
+			name:    "1 byte negative",
+			program: "pushC8 -2 ret64",
+			want:    []byte{0xd8, 0xfe, 0x9},
 		},
 		{
-			name:    "3 byte positive big",
-			program: "pushC64 3d65535 ret64",
-			want:    []byte{0x10, 0xff, 0xff, 0x0, 0x9},
+			name:    "2 byte positive",
+			program: "lfLoadC16 5 ret64",
+			want:    []byte{0x15, 0x05, 0x0, 0x9},
+		},
+		{
+			name:    "2 byte positive big",
+			program: "pushUC16 65535 ret64",
+			want:    []byte{0xdc, 0xff, 0xff, 0x9},
 		},
 		{
 			name:    "2 byte negative",
-			program: "pushC64 2d-2 ret64",
-			want:    []byte{0x10, 0xfe, 0xff, 0x9},
+			program: "pushC16 2d-2 ret64",
+			want:    []byte{0xd9, 0xfe, 0xff, 0x9},
 		},
 		{
 			name:    "2 byte small negative",
-			program: "pushC64 2d-32768 ret64",
-			want:    []byte{0x10, 0x0, 0x80, 0x9},
+			program: "pushC16 -32768 ret64",
+			want:    []byte{0xd9, 0x0, 0x80, 0x9},
+		},
+		{
+			name:    "multiple operands",
+			program: "dRescaleC8 1 2 3",
+			want:    []byte{0xa4, 0x1, 0x2, 0x3},
+		},
+		{
+			name:    "jump table",
+			program: "jmpTable 2 4d-1 4d0 4d1",
+			want:    []byte{0x81, 0x2, 0x0, 0xff, 0xff, 0xff, 0xff, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0},
+		},
+		{
+			name:    "jump table with labels",
+			program: "jmpTable 2 d a b a: ret0 b: ret0 d: ret0",
+			want:    []byte{0x81, 0x2, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x8, 0x8, 0x8},
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := MustAssembleString(testCase.program)
+			assert.Equal(t, testCase.want, got)
+		})
+	}
+}
+
+func TestAssembleString_OperandErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		wantErr string
+	}{
+		{"size mismatch", "pushC64 1d23", "1:9: operand size mismatch: expected 8 bytes: 1d23"},
+		{"missing", "lfLoadC16", "1:1: missing operand: lfLoadC16"},
+		{"missing before instruction", "lfLoadC16 ret0", "1:1: missing operand: lfLoadC16"},
+		{"missing before label", "pushC64 l: ret0", "1:1: missing operand: pushC64"},
+		{"missing repeated", "jmpTable 2 0 0", "1:1: missing operand: jmpTable"},
+		{"extra", "lfLoadC16 5 6", "1:13: unexpected operand: 6"},
+		{"no operands", "ret0 5", "1:6: unexpected operand: 5"},
+		{"signed overflow", "pushC8 128", "1:8: operand out of range: 128"},
+		{"signed underflow", "pushC16 -32769", "1:9: operand out of range: -32769"},
+		{"negative unsigned", "pushUC8 -1", "1:9: operand out of range: -1"},
+		{"unsigned overflow", "pushUC32 0x100000000", "1:10: operand out of range: 0x100000000"},
+		{"int64 overflow", "pushC64 0xffffffffffffffff", "1:9: operand out of range: 0xffffffffffffffff"},
+		{"invalid", "pushC64 x", "1:9: invalid operand: x"},
+		{"label for integer", "lfLoadC16 l l:", "1:11: invalid operand: l"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := AssembleString(testCase.program)
+			assert.Nil(t, got)
+			assert.EqualError(t, err, testCase.wantErr)
+		})
+	}
+}
+
+func TestAssembleString_Labels(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		want    []byte
+	}{
+		{
+			name:    "forward",
+			program: "jmpC16 end noOp end: ret0",
+			want:    []byte{0x70, 0x1, 0x0, 0x0, 0x8},
+		},
+		{
+			name:    "backward",
+			program: "start: noOp jmpC16 start",
+			want:    []byte{0x0, 0x70, 0xfc, 0xff},
+		},
+		{
+			name:    "explicit 32-bit",
+			program: "l: jmpNzC32 l",
+			want:    []byte{0x80, 0xfb, 0xff, 0xff, 0xff},
+		},
+		{
+			name:    "generic short",
+			program: "jmpEq l ret0 l: ret0",
+			want:    []byte{0x17, 0x1, 0x0, 0x8, 0x8},
+		},
+		{
+			name:    "label at end",
+			program: "jmp l l:",
+			want:    []byte{0x70, 0x0, 0x0},
+		},
+		{
+			name:    "numeric offsets still work",
+			program: "jmpC16 2d-3",
+			want:    []byte{0x70, 0xfd, 0xff},
 		},
 	}
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
-			got := AssembleString(testCase.program)
+			got := MustAssembleString(testCase.program)
 			assert.Equal(t, testCase.want, got)
 		})
 	}
 }
+
+func TestAssembleString_BranchRelaxation(t *testing.T) {
+	far := strings.Repeat(" noOp", 40000)
+
+	got := MustAssembleString("jmp l" + far + " l: ret0")
+	assert.Equal(t, []byte{0x78, 0x40, 0x9c, 0x0, 0x0}, got[:5])
+	assert.Equal(t, 5+40000+1, len(got))
+
+	got = MustAssembleString("l:" + far + " jmpZ l")
+	assert.Equal(t, []byte{0x7f, 0xbb, 0x63, 0xff, 0xff}, got[40000:])
+
+	// widening a branch may push another target out of range
+	got = MustAssembleString("jmp a jmp b" + strings.Repeat(" noOp", 32764) + " a: ret0" +
+		strings.Repeat(" noOp", 32767) + " b: ret0")
+	assert.Equal(t, byte(0x78), got[0])
+	assert.Equal(t, byte(0x78), got[5])
+}
+
+func TestAssembleString_LabelErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		program string
+		wantErr string
+	}{
+		{"undefined", "jmp nowhere", "1:5: undefined label: nowhere"},
+		{"duplicate", "l: noOp l: ret0", "1:9: duplicate label: l:"},
+		{"invalid", "2l: ret0", "1:1: invalid label: 2l:"},
+		{"instruction as label", "ret0: ret0", "1:1: invalid label: ret0:"},
+		{"generic without label", "jmpEq 2d3", "1:7: generic branch needs a label operand: 2d3"},
+		{"generic without operand", "jmpEq", "1:1: missing operand: jmpEq"},
+		{"out of range", "jmpC16 l" + strings.Repeat(" noOp", 32768) + " l:",
+			"1:8: branch target out of range for jmpC16: l"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := AssembleString(testCase.program)
+			assert.Nil(t, got)
+			assert.EqualError(t, err, testCase.wantErr)
+		})
+	}
+}
+
+func TestAssembleString_Errors(t *testing.T) {
+	program := `pushC64 1
+	foo lfLoadC16 2d1x
+	jmpC16 missing
+	jmp missing    bar`
+	_, err := AssembleString(program)
+	require.Error(t, err)
+	var list ErrorList
+	require.True(t, errors.As(err, &list))
+	assert.Equal(t, ErrorList{
+		{Line: 2, Column: 2, Token: "foo", Msg: "unknown instruction"},
+		{Line: 2, Column: 16, Token: "2d1x", Msg: "invalid operand"},
+		{Line: 3, Column: 9, Token: "missing", Msg: "undefined label"},
+		{Line: 4, Column: 6, Token: "missing", Msg: "undefined label"},
+		{Line: 4, Column: 17, Token: "bar", Msg: "unknown instruction"},
+	}, list)
+	assert.EqualError(t, err, "2:2: unknown instruction: foo (and 4 more errors)")
+
+	assert.Panics(t, func() { MustAssembleString("foo") })
+}
+
+func TestAssembleString_Instructions(t *testing.T) {
+	for _, info := range avm.Instructions() {
+		// every operand is zero, so repeated operands are not used
+		program := info.Name
+		size := 1
+		for _, f := range operandFormats[info.Name] {
+			if !f.repeated {
+				program += " 0"
+				size += f.size
+			}
+		}
+		got, err := AssembleString(program)
+		assert.NoError(t, err, program)
+		assert.Equal(t, byte(info.Opcode), got[0], program)
+		assert.Len(t, got, size, program)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package assembler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Error is a problem of the program found by the assembler. Line and
+// Column are 1-based and point to the beginning of Token.
+type Error struct {
+	Line   int
+	Column int
+	Token  string
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Msg, e.Token)
+}
+
+// ErrorList is a list of Errors sorted by their position in the program.
+type ErrorList []*Error
+
+func (l *ErrorList) add(t token, msg string) {
+	*l = append(*l, &Error{Line: t.line, Column: t.column, Token: t.text, Msg: msg})
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil if the list is empty, otherwise it returns the sorted list.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].Column < l[j].Column
+	})
+	return l
+}
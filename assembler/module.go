@@ -0,0 +1,177 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package assembler
+
+import (
+	"go-AVM/avm/binary"
+	"go-AVM/avm/prefix"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Chunks is a set of chunks indexed by their root and child identifiers. It
+// can be used for creating a memory.Module.
+type Chunks = map[prefix.Identifier64]map[prefix.Identifier64][]byte
+
+type section int
+
+const (
+	noSection section = iota
+	methodSection
+	chunkSection
+	// the tokens of an invalid section are ignored
+	ignoredSection
+)
+
+// AssembleFile assembles a module source file. See AssembleModule.
+func AssembleFile(path string) (methodArea, heap Chunks, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return AssembleModule(f)
+}
+
+// AssembleModule assembles a module source. A module declares one or more
+// applications, their methods and the initial chunks of their heaps:
+//
+//		.app 0x11            # the application id
+//		.method 0            # a method with local id 0
+//		    pushC64 5 hLoadLocal pushC64 0 hLoad64 ret64
+//		.method 0x12
+//		    ret0
+//		.chunk 5             # a heap chunk with child id 5
+//		    8d-1 2d7 0x55
+//
+// The body of a method is assembled like Assemble. The content of a chunk
+// is a list of constants: a sized constant, like `2d7`, is stored in the
+// given number of bytes and an integer is stored in 8 bytes.
+//
+// methodArea and heap are indexed by the application id and the local id of
+// methods or chunks. If the module has errors, the returned error is an
+// ErrorList which contains all the problems of the module.
+func AssembleModule(r io.Reader) (methodArea, heap Chunks, err error) {
+	tokens, err := scanTokens(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	methodArea, heap = Chunks{}, Chunks{}
+	var (
+		errs    ErrorList
+		app     prefix.Identifier64
+		hasApp  bool
+		current section
+		id      prefix.Identifier64
+		body    []token
+	)
+	flush := func() {
+		switch current {
+		case methodSection:
+			methodArea[app][id] = assembleTokens(body, &errs)
+		case chunkSection:
+			if heap[app] == nil {
+				heap[app] = map[prefix.Identifier64][]byte{}
+			}
+			heap[app][id] = encodeData(body, &errs)
+		}
+		current = noSection
+		body = nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if !strings.HasPrefix(t.text, ".") {
+			if current == noSection {
+				errs.add(t, "statement outside of a method or chunk")
+				current = ignoredSection
+			}
+			body = append(body, t)
+			continue
+		}
+		flush()
+		if t.text != ".app" && t.text != ".method" && t.text != ".chunk" {
+			errs.add(t, "unknown directive")
+			current = ignoredSection
+			continue
+		}
+		if i+1 == len(tokens) || strings.HasPrefix(tokens[i+1].text, ".") {
+			errs.add(t, "missing identifier")
+			current = ignoredSection
+			continue
+		}
+		i++
+		v, e := strconv.ParseUint(tokens[i].text, 0, 64)
+		if e != nil {
+			errs.add(tokens[i], "invalid identifier")
+			current = ignoredSection
+			continue
+		}
+		id = prefix.Identifier64(v)
+		if t.text == ".app" {
+			if _, exists := methodArea[id]; exists {
+				errs.add(tokens[i], "duplicate application")
+			}
+			methodArea[id] = map[prefix.Identifier64][]byte{}
+			app, hasApp = id, true
+			continue
+		}
+
+		current = ignoredSection
+		if !hasApp {
+			errs.add(t, "directive outside of an application")
+		} else if _, exists := methodArea[app][id]; exists && t.text == ".method" {
+			errs.add(tokens[i], "duplicate method")
+		} else if _, exists := heap[app][id]; exists && t.text == ".chunk" {
+			errs.add(tokens[i], "duplicate chunk")
+		} else if t.text == ".method" {
+			current = methodSection
+		} else {
+			current = chunkSection
+		}
+	}
+	flush()
+
+	if err := errs.Err(); err != nil {
+		return nil, nil, err
+	}
+	return methodArea, heap, nil
+}
+
+// encodeData encodes the content of a chunk.
+func encodeData(tokens []token, errs *ErrorList) []byte {
+	// an empty chunk must not be nil, otherwise it would be a deleted chunk
+	data := []byte{}
+	for _, t := range tokens {
+		f := operandFormat{kind: 'b', size: 8}
+		if m := sizedConstant.FindStringSubmatch(t.text); m != nil {
+			f.size, _ = strconv.Atoi(m[1])
+		}
+		v, msg := parseOperand(t.text, f)
+		if msg != "" {
+			errs.add(t, msg)
+			continue
+		}
+		b := make([]byte, 8)
+		binary.PutInt64(b, 0, int64(v))
+		data = append(data, b[:f.size]...)
+	}
+	return data
+}
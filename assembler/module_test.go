@@ -0,0 +1,105 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package assembler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testModule = `
+# a test module
+.app 0x11
+.method 0
+	pushC64 0x12 invokeInternal ret64
+.method 0x12   # labels are local to methods
+	l: jmp l
+.chunk 5
+	8d-1 2d7
+	0x55
+.chunk 6
+.app 12
+.method 0
+	ret0
+`
+
+func TestAssembleModule(t *testing.T) {
+	methodArea, heap, err := AssembleModule(strings.NewReader(testModule))
+	require.NoError(t, err)
+	assert.Equal(t, Chunks{
+		0x11: {
+			0:    MustAssembleString("pushC64 0x12 invokeInternal ret64"),
+			0x12: MustAssembleString("l: jmp l"),
+		},
+		12: {
+			0: MustAssembleString("ret0"),
+		},
+	}, methodArea)
+	assert.Equal(t, Chunks{
+		0x11: {
+			5: {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x07, 0x00,
+				0x55, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			6: {},
+		},
+	}, heap)
+	assert.NotNil(t, heap[0x11][6], "an empty chunk is not a deleted chunk")
+}
+
+func TestAssembleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.avm")
+	require.NoError(t, os.WriteFile(path, []byte(testModule), 0644))
+	methodArea, heap, err := AssembleFile(path)
+	require.NoError(t, err)
+	assert.Len(t, methodArea, 2)
+	assert.Len(t, heap[0x11], 2)
+
+	_, _, err = AssembleFile(filepath.Join(t.TempDir(), "missing.avm"))
+	assert.Error(t, err)
+}
+
+func TestAssembleModule_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  string
+		wantErr string
+	}{
+		{"outside of method", ".app 1 ret0", "1:8: statement outside of a method or chunk: ret0"},
+		{"outside of application", ".method 0 ret0", "1:1: directive outside of an application: .method"},
+		{"unknown directive", ".app 1 .func 0", "1:8: unknown directive: .func"},
+		{"missing identifier", ".app", "1:1: missing identifier: .app"},
+		{"invalid identifier", ".app -1", "1:6: invalid identifier: -1"},
+		{"duplicate application", ".app 1 .app 1", "1:13: duplicate application: 1"},
+		{"duplicate method", ".app 1 .method 2 ret0 .method 2 ret0", "1:31: duplicate method: 2"},
+		{"duplicate chunk", ".app 1 .chunk 2 .chunk 2", "1:24: duplicate chunk: 2"},
+		{"method error", ".app 1\n.method 2\n  pushC8 300", "3:10: operand out of range: 300"},
+		{"chunk error", ".app 1 .chunk 2 1d256", "1:17: operand out of range: 1d256"},
+		{"chunk instruction", ".app 1 .chunk 2 ret0", "1:17: invalid operand: ret0"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			methodArea, heap, err := AssembleModule(strings.NewReader(testCase.module))
+			assert.Nil(t, methodArea)
+			assert.Nil(t, heap)
+			assert.EqualError(t, err, testCase.wantErr)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package assembler
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sizedConstant is a constant with an explicit size in bytes, like `2d-12`.
+var sizedConstant = regexp.MustCompile(`^([1-8])d(-?[0-9]+)$`)
+
+// operandFormat is the format of an immediate operand. See
+// avm.InstructionInfo for the description of formats.
+type operandFormat struct {
+	// kind is one of 'i', 'u', 'b' or 'o'
+	kind byte
+	// size in bytes
+	size     int
+	repeated bool
+}
+
+func parseOperandFormats(operands string) []operandFormat {
+	var formats []operandFormat
+	for _, f := range strings.Fields(operands) {
+		repeated := strings.HasSuffix(f, "*")
+		bits, err := strconv.Atoi(strings.TrimSuffix(f[1:], "*"))
+		if err != nil {
+			panic("invalid operand format: " + f)
+		}
+		formats = append(formats, operandFormat{kind: f[0], size: bits / 8, repeated: repeated})
+	}
+	return formats
+}
+
+// parseOperand parses a constant operand and checks that it fits in the
+// format. The returned value contains the bits of the operand. When the
+// operand is invalid it returns an error message.
+func parseOperand(token string, f operandFormat) (uint64, string) {
+	if m := sizedConstant.FindStringSubmatch(token); m != nil {
+		if size, _ := strconv.Atoi(m[1]); size != f.size {
+			return 0, "operand size mismatch: expected " + strconv.Itoa(f.size) + " bytes"
+		}
+		token = m[2]
+	}
+	v, err := strconv.ParseInt(token, 0, 64)
+	if err == nil {
+		if !fits(v, f) {
+			return 0, "operand out of range"
+		}
+		return uint64(v), ""
+	}
+	if u, e := strconv.ParseUint(token, 0, 64); e == nil {
+		// the value does not fit in an int64
+		if f.size != 8 || f.kind == 'i' || f.kind == 'o' {
+			return 0, "operand out of range"
+		}
+		return u, ""
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, "operand out of range"
+	}
+	return 0, "invalid operand"
+}
+
+func fits(v int64, f operandFormat) bool {
+	switch f.kind {
+	case 'u':
+		return v >= 0 && (f.size == 8 || v < 1<<(8*f.size))
+	case 'b':
+		// raw bytes can be written as signed or unsigned integers
+		return f.size == 8 || v >= -1<<(8*f.size-1) && v < 1<<(8*f.size)
+	default:
+		return fitsSigned(v, f.size)
+	}
+}
+
+func fitsSigned(v int64, size int) bool {
+	return size == 8 || v >= -1<<(8*size-1) && v < 1<<(8*size-1)
+}
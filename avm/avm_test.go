@@ -18,14 +18,21 @@
 package avm_test
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go-AVM/assembler"
 	"go-AVM/avm"
+	"go-AVM/avm/binary"
 	"go-AVM/avm/memory"
 	"go-AVM/avm/prefix"
+	"math"
+	"strings"
 	"testing"
 )
 
+const defaultGasLimit = 1000000
+
 func TestController_Emulate(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -33,6 +40,7 @@ func TestController_Emulate(t *testing.T) {
 		heap              *memory.Module
 		calledApp         prefix.Identifier64
 		arguments         []byte
+		gasLimit          uint64
 		wantOutput        []byte
 		wantMethodAreaLog string
 		wantHeapLog       string
@@ -54,7 +62,7 @@ func TestController_Emulate(t *testing.T) {
 			name: "simple return",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0:  assembler.AssembleString("pushC64 2 pushC64 3 iAdd ret64"),
+					0:  assembler.MustAssembleString("pushC64 2 pushC64 3 iAdd ret64"),
 					10: []byte{},
 				},
 			}),
@@ -66,7 +74,7 @@ func TestController_Emulate(t *testing.T) {
 			name: "nonexistent App",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 443 invokeDispatcher ret0"),
+					0: assembler.MustAssembleString("pushC64 443 invokeDispatcher ret0"),
 				},
 			}),
 			calledApp:   0x11,
@@ -78,7 +86,7 @@ func TestController_Emulate(t *testing.T) {
 			name: "catch nonexistent App error",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 443 indInvokeDispatcher pushC64 7 ret64"),
+					0: assembler.MustAssembleString("pushC64 443 indInvokeDispatcher pushC64 7 ret64"),
 				},
 			}),
 			calledApp:   0x11,
@@ -86,14 +94,41 @@ func TestController_Emulate(t *testing.T) {
 			wantHeapLog: "root<-11   Save   root<-1bb   Save   Restore   root<-11   Discard",
 			wantError:   avm.NoError,
 		},
+		{
+			name: "spawn nonexistent App",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 0x12 spawnDispatcher ret0"),
+				},
+			}),
+			calledApp:   0x11,
+			wantOutput:  nil,
+			wantHeapLog: "root<-11   Save   Restore",
+			wantError:   avm.InvalidReference,
+		},
+		{
+			name: "spawn",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 0x12 spawnDispatcher ret0"),
+				},
+				0x12: {
+					0: assembler.MustAssembleString("ret0"),
+				},
+			}),
+			calledApp:   0x11,
+			wantOutput:  nil,
+			wantHeapLog: "root<-11   Save   Discard   Save   root<-12   Discard",
+			wantError:   avm.NoError,
+		},
 		{
 			name: "multiple internal return",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("pushC64 1 invokeInternal pushC64 1 iAdd ret64"),
-					1: assembler.AssembleString("pushC64 2 invokeInternal pushC64 2 iAdd ret64"),
-					2: assembler.AssembleString("pushC64 3 invokeInternal pushC64 3 iAdd ret64"),
-					3: assembler.AssembleString("pushC64 10 ret64"),
+					0: assembler.MustAssembleString("pushC64 1 invokeInternal pushC64 1 iAdd ret64"),
+					1: assembler.MustAssembleString("pushC64 2 invokeInternal pushC64 2 iAdd ret64"),
+					2: assembler.MustAssembleString("pushC64 3 invokeInternal pushC64 3 iAdd ret64"),
+					3: assembler.MustAssembleString("pushC64 10 ret64"),
 				},
 			}),
 			calledApp:  17,
@@ -104,8 +139,8 @@ func TestController_Emulate(t *testing.T) {
 			name: "parameter passing",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("pushC64 777777 argC16 2d0 pushC64 5 invokeInternal ret64"),
-					5: assembler.AssembleString("lfLoadC16 2d0 pushC64 10 iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 777777 argC16 2d0 pushC64 5 invokeInternal ret64"),
+					5: assembler.MustAssembleString("lfLoadC16 2d0 pushC64 10 iAdd ret64"),
 				},
 			}),
 			calledApp:  17,
@@ -118,7 +153,7 @@ func TestController_Emulate(t *testing.T) {
 			name: "simple throw",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("pushC64 566265685016576 throw"),
+					0: assembler.MustAssembleString("pushC64 566265685016576 throw"),
 				},
 			}),
 			calledApp:  17,
@@ -129,21 +164,21 @@ func TestController_Emulate(t *testing.T) {
 			name: "failed throw",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0:    assembler.AssembleString("pushC64 5 pushC64 0x12 invokeInternal ret64"),
-					0x12: assembler.AssembleString("pushC64 0x0700000000000000 throw"),
+					0:    assembler.MustAssembleString("pushC64 5 pushC64 0x12 invokeInternal ret64"),
+					0x12: assembler.MustAssembleString("pushC64 0x0700000000000000 throw"),
 				},
 			}),
 			calledApp:   0x11,
 			wantOutput:  nil,
 			wantHeapLog: "root<-11   Save   root<-11   Restore",
-			wantError:   avm.InvalidReference,
+			wantError:   avm.StackUnderflow,
 		},
 		{
 			name: "catch failed throw",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0:    assembler.AssembleString("pushC64 5 pushC64 0x12 indInvokeInternal ret64"),
-					0x12: assembler.AssembleString("pushC64 0x0700000000000000 throw"),
+					0:    assembler.MustAssembleString("pushC64 5 pushC64 0x12 indInvokeInternal ret64"),
+					0x12: assembler.MustAssembleString("pushC64 0x0700000000000000 throw"),
 				},
 			}),
 			calledApp:   0x11,
@@ -155,10 +190,10 @@ func TestController_Emulate(t *testing.T) {
 			name: "multiple throw",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("pushC64 1 invokeInternal pushC64 1 iAdd ret64"),
-					1: assembler.AssembleString("pushC64 2 invokeInternal pushC64 2 iAdd ret64"),
-					2: assembler.AssembleString("pushC64 3 invokeInternal pushC64 3 iAdd ret64"),
-					3: assembler.AssembleString("pushC64 566265685016576 throw iAdd"),
+					0: assembler.MustAssembleString("pushC64 1 invokeInternal pushC64 1 iAdd ret64"),
+					1: assembler.MustAssembleString("pushC64 2 invokeInternal pushC64 2 iAdd ret64"),
+					2: assembler.MustAssembleString("pushC64 3 invokeInternal pushC64 3 iAdd ret64"),
+					3: assembler.MustAssembleString("pushC64 566265685016576 throw iAdd"),
 				},
 			}),
 			calledApp:  17,
@@ -169,16 +204,16 @@ func TestController_Emulate(t *testing.T) {
 			name: "multiple external throw",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 6 pushC64 0x12 invokeDispatcher iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 6 pushC64 0x12 invokeDispatcher iAdd ret64"),
 				},
 				0x12: {
-					0: assembler.AssembleString("pushC64 0x13 invokeDispatcher pushC64 20 iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 0x13 invokeDispatcher pushC64 20 iAdd ret64"),
 				},
 				0x13: {
-					0: assembler.AssembleString("pushC64 0x14 invokeDispatcher pushC64 30 iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 0x14 invokeDispatcher pushC64 30 iAdd ret64"),
 				},
 				0x14: {
-					0: assembler.AssembleString("pushC64 0x0006000000000001 throw ret0"),
+					0: assembler.MustAssembleString("pushC64 0x0006000000000001 throw ret0"),
 				},
 			}),
 			calledApp:   0x11,
@@ -190,16 +225,16 @@ func TestController_Emulate(t *testing.T) {
 			name: "multi throw and catch",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 6 pushC64 0x12 indInvokeDispatcher iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 6 pushC64 0x12 indInvokeDispatcher iAdd ret64"),
 				},
 				0x12: {
-					0: assembler.AssembleString("pushC64 0x13 invokeDispatcher pushC64 20 iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 0x13 invokeDispatcher pushC64 20 iAdd ret64"),
 				},
 				0x13: {
-					0: assembler.AssembleString("pushC64 0x14 invokeDispatcher pushC64 30 iAdd ret64"),
+					0: assembler.MustAssembleString("pushC64 0x14 invokeDispatcher pushC64 30 iAdd ret64"),
 				},
 				0x14: {
-					0: assembler.AssembleString("pushC64 0x0006000000000001 throw ret0"),
+					0: assembler.MustAssembleString("pushC64 0x0006000000000001 throw ret0"),
 				},
 			}),
 			calledApp:   0x11,
@@ -213,11 +248,11 @@ func TestController_Emulate(t *testing.T) {
 			name: "simple lock",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 6 pushC64 0x2 invokeInternal iAdd ret64"),
-					2: assembler.AssembleString("enter pushC64 4 pushC64 0x12 invokeDispatcher ret64"),
+					0: assembler.MustAssembleString("pushC64 6 pushC64 0x2 invokeInternal iAdd ret64"),
+					2: assembler.MustAssembleString("enter pushC64 4 pushC64 0x12 invokeDispatcher ret64"),
 				},
 				0x12: {
-					0: assembler.AssembleString("pushC64 0x11 invokeDispatcher ret64"),
+					0: assembler.MustAssembleString("pushC64 0x11 invokeDispatcher ret64"),
 				},
 			}),
 			calledApp:   0x11,
@@ -229,11 +264,11 @@ func TestController_Emulate(t *testing.T) {
 			name: "simple lock catch",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 6 pushC64 0x2 invokeInternal iAdd ret64"),
-					2: assembler.AssembleString("enter pushC64 4 pushC64 0x12 indInvokeDispatcher ret64"),
+					0: assembler.MustAssembleString("pushC64 6 pushC64 0x2 invokeInternal iAdd ret64"),
+					2: assembler.MustAssembleString("enter pushC64 4 pushC64 0x12 indInvokeDispatcher ret64"),
 				},
 				0x12: {
-					0: assembler.AssembleString("pushC64 0x11 invokeDispatcher ret64"),
+					0: assembler.MustAssembleString("pushC64 0x11 invokeDispatcher ret64"),
 				},
 			}),
 			calledApp:  0x11,
@@ -246,12 +281,14 @@ func TestController_Emulate(t *testing.T) {
 			name: "simple lock opening",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				0x11: {
-					0: assembler.AssembleString("pushC64 0x2 invokeInternal lfLoadC16 2d0 jmpEqC16 2d10" +
-						" pushC64 0x12 invokeDispatcher iAdd ret64"),
-					2: assembler.AssembleString("enter pushC64 4 ret64"),
+					0: assembler.MustAssembleString("pushC64 0x2 invokeInternal lfStoreC16 2d8" +
+						" lfLoadC16 2d8 lfLoadC16 2d0 jmpEqC16 2d15" +
+						" lfLoadC16 2d0 pushC64 0x12 invokeDispatcher iAdd ret64" +
+						" lfLoadC16 2d0 lfLoadC16 2d8 iAdd ret64"),
+					2: assembler.MustAssembleString("enter pushC64 4 ret64"),
 				},
 				0x12: {
-					0: assembler.AssembleString("pushC64 4 argC16 2d0 pushC64 0x11 invokeDispatcher ret64"),
+					0: assembler.MustAssembleString("pushC64 4 argC16 2d0 pushC64 0x11 invokeDispatcher ret64"),
 				},
 			}),
 			calledApp:  0x11,
@@ -260,12 +297,209 @@ func TestController_Emulate(t *testing.T) {
 			wantError:  avm.NoError,
 		},
 
+		// Validation tests:
+		{
+			name: "invalid opcode",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: []byte{0xff},
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.InvalidOpcode,
+		},
+		{
+			name: "jump out of method",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("jmpC16 2d100 ret0"),
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.PcOutOfRange,
+		},
+		{
+			name: "truncated constant",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: {0x10, 0x05, 0x00, 0x00},
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.PcOutOfRange,
+		},
+		{
+			name: "catch stack underflow",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0:    assembler.MustAssembleString("pushC64 5 pushC64 0x12 indInvokeInternal ret64"),
+					0x12: assembler.MustAssembleString("pushC64 1 iAdd ret64"),
+				},
+			}),
+			calledApp:   0x11,
+			wantOutput:  []byte{0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			wantHeapLog: "root<-11   Save   root<-11   Save   Restore   root<-11   Discard",
+			wantError:   avm.NoError,
+		},
+		{
+			name: "return underflow",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("ret64"),
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.StackUnderflow,
+		},
+		{
+			name: "local frame out of range",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("lfLoadC16 2d0 ret64"),
+				},
+			}),
+			calledApp: 0x11,
+			arguments: []byte{1, 2, 3, 4},
+			wantError: avm.LocalFrameOutOfRange,
+		},
+
+		// Heap tests:
+		{
+			name: "heap store and load",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 77 pushC64 0 hStore64 pushC64 0 hLoad64 ret64"),
+				},
+			}),
+			heap: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {5: make([]byte, 8)},
+			}),
+			calledApp:   0x11,
+			wantOutput:  []byte{77, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			wantHeapLog: "root<-11   Save   child<-5   [0]<-4d00000000000000   [0]->4d   Discard",
+			wantError:   avm.NoError,
+		},
+		{
+			name: "heap narrow load",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 0x1122334455667788 pushC64 0 hStore64 " +
+						"pushC64 2 hLoad16 pushC64 0x99 pushC64 7 hStore8 pushC64 4 hLoad32 iAdd ret64"),
+				},
+			}),
+			calledApp:  0x11,
+			wantOutput: []byte{0xaa, 0x88, 0x22, 0x99, 0x0, 0x0, 0x0, 0x0},
+			wantError:  avm.NoError,
+		},
+		{
+			name: "heap bytes",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 0x1122334455667788 pushC64 3 " +
+						"hStoreBytesC16 2d6 pushC64 0 pushC64 5 hLoadBytesC16 2d4 ret64"),
+				},
+			}),
+			calledApp:   0x11,
+			wantOutput:  []byte{0x0, 0x0, 0x0, 0x0, 0x44, 0x33, 0x22, 0x11},
+			wantHeapLog: "root<-11   Save   child<-5   [3]<-665544332211   [5]->44332211   Discard",
+			wantError:   avm.NoError,
+		},
+		{
+			name: "heap no chunk",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal hUnLoadLocal pushC64 0 hLoad64 ret64"),
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.InvalidReference,
+		},
+		{
+			name: "heap out of range",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 1 pushC64 0 hStore32 pushC64 1 hLoad32 ret64"),
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.InvalidReference,
+		},
+		{
+			name: "heap revert",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 1 pushC64 0 hStore8 " +
+						"pushC64 2 indInvokeInternal pushC64 0 hLoad64 ret64"),
+					2: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 2 pushC64 1 hStore8 pushC64 99 hLoad64"),
+				},
+			}),
+			heap: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {5: make([]byte, 8)},
+			}),
+			calledApp:  0x11,
+			wantOutput: []byte{0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			wantHeapLog: "root<-11   Save   child<-5   [0]<-01   root<-11   Save   child<-5   [1]<-02   " +
+				"Restore   root<-11   child<-5   [0]->1   Discard",
+			wantError: avm.NoError,
+		},
+		{
+			name: "heap merge",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 1 pushC64 0 hStore8 " +
+						"pushC64 2 indInvokeInternal pushC64 0 hLoad64 ret64"),
+					2: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 2 pushC64 1 hStore8 ret0"),
+				},
+			}),
+			heap: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {5: make([]byte, 8)},
+			}),
+			calledApp:  0x11,
+			wantOutput: []byte{0x1, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+			wantError:  avm.NoError,
+		},
+
+		// Gas tests:
+		{
+			name: "infinite loop",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("jmpC16 2d-3"),
+				},
+			}),
+			calledApp: 0x11,
+			wantError: avm.OutOfGas,
+		},
+		{
+			name: "catch out of gas",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 2 indInvokeInternal pushC64 7 ret64"),
+					2: assembler.MustAssembleString("jmpC16 2d-3"),
+				},
+			}),
+			calledApp:   0x11,
+			wantHeapLog: "root<-11   Save   root<-11   Save   Restore   root<-11   Restore",
+			wantError:   avm.OutOfGas,
+		},
+		{
+			name: "stack growth",
+			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0: assembler.MustAssembleString("pushC64 0 jmpC16 2d-12"),
+				},
+			}),
+			calledApp: 0x11,
+			gasLimit:  1 << 40,
+			wantError: avm.StackOverflow,
+		},
+
 		// Full programs:
 		{
 			name: "sum 1:1",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("lfLoadC16 2d0 pushC64 -1 jmpEqC16 2d19 iAdd " +
+					0: assembler.MustAssembleString("lfLoadC16 2d0 jmpZC16 2d31 lfLoadC16 2d0 pushC64 -1 iAdd " +
 						"argC16 2d0 pushC64 0 invokeInternal lfLoadC16 2d0 iAdd ret64 pushC64 0 ret64"),
 				},
 			}),
@@ -278,7 +512,7 @@ func TestController_Emulate(t *testing.T) {
 			name: "sum 1:200",
 			methodArea: memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 				17: {
-					0: assembler.AssembleString("lfLoadC16 2d0 pushC64 -1 jmpEqC16 2d19 iAdd " +
+					0: assembler.MustAssembleString("lfLoadC16 2d0 jmpZC16 2d31 lfLoadC16 2d0 pushC64 -1 iAdd " +
 						"argC16 2d0 pushC64 0 invokeInternal lfLoadC16 2d0 iAdd ret64 pushC64 0 ret64"),
 				},
 			}),
@@ -296,11 +530,15 @@ func TestController_Emulate(t *testing.T) {
 			if testCase.heap == nil {
 				testCase.heap = memory.NewMocker(nil)
 			}
+			if testCase.gasLimit == 0 {
+				testCase.gasLimit = defaultGasLimit
+			}
 			controller.SetupNewSession(
 				testCase.calledApp,
 				testCase.arguments,
 				testCase.methodArea,
 				testCase.heap,
+				testCase.gasLimit,
 			)
 			gotOutput, gotError := controller.Emulate()
 			assert.Equal(t, testCase.wantOutput, gotOutput, "invalid output")
@@ -312,19 +550,634 @@ func TestController_Emulate(t *testing.T) {
 	}
 }
 
+func TestController_GasUsed(t *testing.T) {
+	schedule := avm.DefaultGasSchedule()
+	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString("pushC64 2 pushC64 3 iAdd pushC64 1 invokeInternal ret64"),
+			1: assembler.MustAssembleString("ret0"),
+		},
+	})
+	instructions := []byte{0x10, 0x10, 0x12, 0x10, 0x04, 0x08, 0x09}
+	var want uint64
+	for _, opcode := range instructions {
+		want += schedule.Instructions[opcode]
+	}
+	want += schedule.ChunkLoad + schedule.ChunkByte*1
+
+	controller := avm.NewController().SetGasSchedule(schedule)
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	_, gotError := controller.Emulate()
+	assert.Equal(t, avm.NoError, gotError)
+	assert.Equal(t, want, controller.GasUsed())
+
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), want-1)
+	_, gotError = controller.Emulate()
+	assert.Equal(t, avm.OutOfGas, gotError)
+	assert.Equal(t, want-1, controller.GasUsed())
+
+	// running out of gas while paying for the chunk of an independent call
+	// must fail the caller, before the callee is pushed
+	methodArea = memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString("pushC64 1 indInvokeInternal ret0"),
+			1: assembler.MustAssembleString("ret0"),
+		},
+	})
+	heap := memory.NewMocker(nil)
+	limit := schedule.Instructions[0x10] + schedule.Instructions[0x05] + schedule.ChunkLoad
+	controller.SetupNewSession(0x11, nil, methodArea, heap, limit)
+	result := controller.Execute()
+	assert.Equal(t, avm.OutOfGas, result.Error)
+	assert.Equal(t, &avm.Failure{App: 0x11, Method: 0, PC: 9, CallDepth: 1}, result.Failure)
+	assert.Equal(t, "root<-11   Save   Restore", heap.AccessLog())
+
+	// the dispatcher chunk of a spawned call is charged when it is spawned
+	methodArea = memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString("pushC64 0x12 spawnDispatcher ret0"),
+		},
+		0x12: {
+			0: assembler.MustAssembleString("pushC64 1 ret0"),
+		},
+	})
+	want = schedule.Instructions[0x10]*2 + schedule.Instructions[0x03] + schedule.Instructions[0x08]*2 +
+		schedule.ChunkLoad + schedule.ChunkByte*10
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	_, gotError = controller.Emulate()
+	assert.Equal(t, avm.NoError, gotError)
+	assert.Equal(t, want, controller.GasUsed())
+
+	limit = schedule.Instructions[0x10] + schedule.Instructions[0x03] + schedule.ChunkLoad
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), limit)
+	result = controller.Execute()
+	assert.Equal(t, avm.OutOfGas, result.Error)
+	assert.Equal(t, &avm.Failure{App: 0x11, Method: 0, PC: 9, CallDepth: 1}, result.Failure)
+}
+
+func TestController_Execute(t *testing.T) {
+	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString("pushC64 5 hLoadLocal pushC64 0x0102000000000000 emitC16 2d2 " +
+				"pushC64 0x12 indInvokeInternal pushC64 7 ret64"),
+			0x12: assembler.MustAssembleString("pushC64 6 hLoadLocal pushC64 0x0300000000000000 emitC16 2d1 " +
+				"pushC64 0 pushC64 0 iDiv ret64"),
+		},
+	})
+	controller := avm.NewController()
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	result := controller.Execute()
+	assert.Equal(t, []byte{7, 0, 0, 0, 0, 0, 0, 0}, result.ReturnData)
+	assert.Equal(t, avm.NoError, result.Error)
+	assert.Nil(t, result.Failure)
+	assert.Equal(t, controller.GasUsed(), result.GasUsed)
+	assert.Equal(t, uint64(15), result.InstructionCount)
+	assert.Equal(t, []avm.Event{{App: 0x11, Data: []byte{2, 1}}}, result.Events,
+		"the events of the failed call must be reverted")
+	assert.Equal(t, []memory.ChunkID{{Root: 0x11, Child: 5}, {Root: 0x11, Child: 6}}, result.TouchedChunks)
+
+	methodArea = memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0:    assembler.MustAssembleString("pushC64 0x13 invokeInternal ret64"),
+			0x12: assembler.MustAssembleString("pushC64 0x0300000000000000 emitC16 2d1 pushC64 0 pushC64 0 iDiv ret64"),
+			0x13: assembler.MustAssembleString("pushC64 0x12 invokeInternal ret64"),
+		},
+	})
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	result = controller.Execute()
+	assert.Equal(t, avm.DivisionByZero, result.Error)
+	assert.Empty(t, result.Events)
+	assert.Equal(t, &avm.Failure{App: 0x11, Method: 0x12, PC: 30, CallDepth: 3}, result.Failure)
+}
+
+func TestController_Module(t *testing.T) {
+	methodArea, heap, err := assembler.AssembleModule(strings.NewReader(`
+		.app 0x11
+		.method 0
+			pushC64 5 hLoadLocal pushC64 0 hLoad64
+			pushC64 0x12 invokeInternal iAdd ret64
+		.method 0x12
+			pushC64 1 ret64
+		.chunk 5
+			42
+	`))
+	require.NoError(t, err)
+	controller := avm.NewController()
+	controller.SetupNewSession(0x11, nil, memory.NewMocker(methodArea), memory.NewMocker(heap), defaultGasLimit)
+	got, gotError := controller.Emulate()
+	assert.Equal(t, avm.NoError, gotError)
+	assert.Equal(t, int64(43), binary.ReadInt64(got, 0))
+}
+
+type failingStore struct {
+	*memory.MapStore
+	failing memory.ChunkID
+}
+
+func (s *failingStore) Get(root, child prefix.Identifier64) ([]byte, error) {
+	if (memory.ChunkID{Root: root, Child: child}) == s.failing {
+		return nil, errors.New("disk failure")
+	}
+	return s.MapStore.Get(root, child)
+}
+
+func TestController_StorageError(t *testing.T) {
+	chunks := map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0:    assembler.MustAssembleString("pushC64 0x12 indInvokeInternal ret64"),
+			0x12: assembler.MustAssembleString("pushC64 1 ret64"),
+		},
+		0x12: {
+			0: assembler.MustAssembleString("pushC64 0x13 spawnDispatcher pushC64 5 hLoadLocal ret0"),
+		},
+		0x13: {
+			0: assembler.MustAssembleString("ret0"),
+		},
+	}
+	tests := []struct {
+		name      string
+		calledApp prefix.Identifier64
+		method    memory.ChunkID
+		heap      memory.ChunkID
+	}{
+		{"called dispatcher", 0x11, memory.ChunkID{Root: 0x11}, memory.ChunkID{Root: 1}},
+		{"invoked method", 0x11, memory.ChunkID{Root: 0x11, Child: 0x12}, memory.ChunkID{Root: 1}},
+		{"spawned dispatcher", 0x12, memory.ChunkID{Root: 0x13}, memory.ChunkID{Root: 1}},
+		{"heap chunk", 0x12, memory.ChunkID{Root: 1}, memory.ChunkID{Root: 0x12, Child: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			methodArea := memory.New(&failingStore{memory.NewMapStore(chunks), tt.method})
+			heap := memory.New(&failingStore{memory.NewMapStore(nil), tt.heap})
+			controller := avm.NewController()
+			controller.SetupNewSession(tt.calledApp, nil, methodArea, heap, defaultGasLimit)
+			result := controller.Execute()
+			assert.Equal(t, avm.StorageError, result.Error)
+			assert.Nil(t, result.ReturnData)
+			assert.NoError(t, heap.Commit(), "all checkpoints must be closed")
+		})
+	}
+}
+
+// runProgram runs a single method program and returns the first 8 bytes of
+// the output as an int64
+func runProgram(program string) (int64, avm.ErrorCode) {
+	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString(program),
+		},
+	})
+	controller := avm.NewController()
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	output, err := controller.Emulate()
+	if len(output) < 8 {
+		return 0, err
+	}
+	return binary.ReadInt64(output, 0), err
+}
+
+func TestProcessor_IntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{"pushC64 -7 pushC64 6 iMul", -42, avm.NoError},
+		{"pushC64 0x7fffffffffffffff pushC64 2 iMul", -2, avm.NoError},
+		{"pushC64 -7 pushC64 2 iDiv", -3, avm.NoError},
+		{"pushC64 -7 pushC64 2 iRem", -1, avm.NoError},
+		{"pushC64 7 pushC64 -2 iRem", 1, avm.NoError},
+		{"pushC64 7 pushC64 0 iDiv", 0, avm.DivisionByZero},
+		{"pushC64 7 pushC64 0 iRem", 0, avm.DivisionByZero},
+		{"pushC64 -9223372036854775808 pushC64 -1 iDiv", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 pushC64 -1 iRem", 0, avm.NoError},
+		{"pushC64 5 iNeg", -5, avm.NoError},
+		{"pushC64 -9223372036854775808 iNeg", math.MinInt64, avm.NoError},
+		{"pushC64 -5 iAbs", 5, avm.NoError},
+		{"pushC64 -3 pushC64 2 iMin", -3, avm.NoError},
+		{"pushC64 -3 pushC64 2 iMax", 2, avm.NoError},
+		{"pushC64 -1 pushC64 2 uDiv", math.MaxInt64, avm.NoError},
+		{"pushC64 -1 pushC64 10 uRem", 5, avm.NoError},
+		{"pushC64 1 pushC64 0 uDiv", 0, avm.DivisionByZero},
+		{"pushC64 1 pushC64 0 uRem", 0, avm.DivisionByZero},
+		{"pushC64 -3 pushC64 2 uMin", 2, avm.NoError},
+		{"pushC64 -3 pushC64 2 uMax", -3, avm.NoError},
+		{"pushC64 0x7ffffffffffffffe pushC64 1 iAddChk", math.MaxInt64, avm.NoError},
+		{"pushC64 0x7fffffffffffffff pushC64 1 iAddChk", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 pushC64 -1 iAddChk", 0, avm.UnderFlow},
+		{"pushC64 -9223372036854775808 pushC64 1 iSubChk", 0, avm.UnderFlow},
+		{"pushC64 0x7fffffffffffffff pushC64 -1 iSubChk", 0, avm.OverFlow},
+		{"pushC64 -2 pushC64 5 iSubChk", -7, avm.NoError},
+		{"pushC64 0x100000000 pushC64 0x80000000 iMulChk", 0, avm.OverFlow},
+		{"pushC64 0x100000000 pushC64 -0x80000000 iMulChk", math.MinInt64, avm.NoError},
+		{"pushC64 0x100000000 pushC64 -0x80000001 iMulChk", 0, avm.UnderFlow},
+		{"pushC64 -9223372036854775808 pushC64 -1 iMulChk", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 iNegChk", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 iAbsChk", 0, avm.OverFlow},
+		{"pushC64 -6 iAbsChk", 6, avm.NoError},
+		{"pushC64 -1 pushC64 1 uAddChk", 0, avm.OverFlow},
+		{"pushC64 -2 pushC64 1 uAddChk", -1, avm.NoError},
+		{"pushC64 1 pushC64 2 uSubChk", 0, avm.UnderFlow},
+		{"pushC64 0x100000000 pushC64 0x100000000 uMulChk", 0, avm.OverFlow},
+		{"pushC64 0x100000000 pushC64 0xffffffff uMulChk", -0x100000000, avm.NoError},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_BitwiseAndComparison(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue int64
+	}{
+		{"pushC64 0b1100 pushC64 0b1010 and", 0b1000},
+		{"pushC64 0b1100 pushC64 0b1010 or", 0b1110},
+		{"pushC64 0b1100 pushC64 0b1010 xor", 0b0110},
+		{"pushC64 0 not", -1},
+		{"pushC64 3 pushC64 4 shl", 48},
+		{"pushC64 3 pushC64 64 shl", 0},
+		{"pushC64 -16 pushC64 2 shr", 0x3ffffffffffffffc},
+		{"pushC64 -16 pushC64 2 sar", -4},
+		{"pushC64 -16 pushC64 100 sar", -1},
+		{"pushC64 16 pushC64 -1 shr", 0},
+		{"pushC64 -9223372036854775807 pushC64 1 rotl", 3},
+		{"pushC64 -9223372036854775807 pushC64 65 rotl", 3},
+		{"pushC64 3 pushC64 1 rotr", -9223372036854775807},
+		{"pushC64 0xf0f0 popCnt", 8},
+		{"pushC64 0xff clz", 56},
+		{"pushC64 0 clz", 64},
+		{"pushC64 0x100 ctz", 8},
+		{"pushC64 0 ctz", 64},
+		{"pushC64 5 pushC64 5 eq", 1},
+		{"pushC64 5 pushC64 6 eq", 0},
+		{"pushC64 5 pushC64 6 ne", 1},
+		{"pushC64 -1 pushC64 1 iLt", 1},
+		{"pushC64 -1 pushC64 1 uLt", 0},
+		{"pushC64 1 pushC64 1 iLe", 1},
+		{"pushC64 2 pushC64 1 iLe", 0},
+		{"pushC64 -1 pushC64 1 iGt", 0},
+		{"pushC64 -1 pushC64 1 uGt", 1},
+		{"pushC64 -1 pushC64 -1 iGe", 1},
+		{"pushC64 1 pushC64 -1 uGe", 0},
+		{"pushC64 1 pushC64 1 uLe", 1},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, avm.NoError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_Branches(t *testing.T) {
+	tests := []struct {
+		condition string
+		wantTaken bool
+	}{
+		{"jmpC16 2d10", true},
+		{"pushC64 3 pushC64 3 jmpEqC16 2d10", true},
+		{"pushC64 3 pushC64 4 jmpEqC16 2d10", false},
+		{"pushC64 3 pushC64 4 jmpNeC16 2d10", true},
+		{"pushC64 3 pushC64 3 jmpNeC16 2d10", false},
+		{"pushC64 -1 pushC64 1 jmpLtC16 2d10", true},
+		{"pushC64 1 pushC64 1 jmpLtC16 2d10", false},
+		{"pushC64 1 pushC64 1 jmpGeC16 2d10", true},
+		{"pushC64 -1 pushC64 1 jmpGeC16 2d10", false},
+		{"pushC64 -1 pushC64 1 jmpULtC16 2d10", false},
+		{"pushC64 1 pushC64 -1 jmpULtC16 2d10", true},
+		{"pushC64 -1 pushC64 1 jmpUGeC16 2d10", true},
+		{"pushC64 0 jmpZC16 2d10", true},
+		{"pushC64 7 jmpZC16 2d10", false},
+		{"pushC64 7 jmpNzC16 2d10", true},
+		{"pushC64 0 jmpNzC16 2d10", false},
+		{"jmpC32 4d10", true},
+		{"pushC64 3 pushC64 3 jmpEqC32 4d10", true},
+		{"pushC64 3 pushC64 4 jmpNeC32 4d10", true},
+		{"pushC64 -1 pushC64 1 jmpLtC32 4d10", true},
+		{"pushC64 -1 pushC64 1 jmpGeC32 4d10", false},
+		{"pushC64 -1 pushC64 1 jmpULtC32 4d10", false},
+		{"pushC64 -1 pushC64 1 jmpUGeC32 4d10", true},
+		{"pushC64 0 jmpZC32 4d10", true},
+		{"pushC64 0 jmpNzC32 4d10", false},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.condition, func(t *testing.T) {
+			// the operands of the branch must be popped, so the stack of the
+			// taken path should be empty.
+			got, gotError := runProgram(testCase.condition + " pushC64 0 ret64 pushC64 1 ret64")
+			assert.Equal(t, avm.NoError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantTaken, got == 1, "invalid branch")
+		})
+	}
+}
+
+func TestProcessor_Loop(t *testing.T) {
+	// computes 1 + 2 + ... + 10 using a backward branch to a label
+	got, gotError := runProgram("pushC64 10 pushC64 0 " +
+		"loop: over iAdd swap pushC64 1 iSub swap over jmpNz loop " +
+		"swap pop ret64")
+	assert.Equal(t, avm.NoError, gotError)
+	assert.Equal(t, int64(55), got)
+}
+
+func TestProcessor_JumpTable(t *testing.T) {
+	const targets = " pushC64 10 ret64 pushC64 11 ret64 pushC64 12 ret64"
+	tests := []struct {
+		index     string
+		wantValue int64
+	}{
+		{"0", 11},
+		{"1", 12},
+		{"2", 10},
+		{"-1", 10},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.index, func(t *testing.T) {
+			got, gotError := runProgram("pushC64 " + testCase.index + " jmpTable 2d2 4d0 4d10 4d20" + targets)
+			assert.Equal(t, avm.NoError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+	got, gotError := runProgram("pushC64 0 jmpTable 2d0 4d10" + targets)
+	assert.Equal(t, avm.NoError, gotError, "invalid error code")
+	assert.Equal(t, int64(11), got, "an empty table should always use the default offset")
+}
+
+func TestProcessor_FloatingPoint(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue float64
+		wantError avm.ErrorCode
+	}{
+		{"pushC64 3 iToF pushC64 2 iToF fAdd", 5, avm.NoError},
+		{"pushC64 3 iToF pushC64 2 iToF fSub", 1, avm.NoError},
+		{"pushC64 3 iToF pushC64 2 iToF fMul", 6, avm.NoError},
+		{"pushC64 3 iToF pushC64 2 iToF fDiv", 1.5, avm.NoError},
+		{"pushC64 2 iToF fSqrt", math.Sqrt2, avm.NoError},
+		{"pushC64 2 iToF fNeg", -2, avm.NoError},
+		{"pushC64 -2 iToF fAbs", 2, avm.NoError},
+		{"pushC64 1 iToF pushC64 3 iToF fDiv fTruncC8 1d2", 0.25, avm.NoError},
+		{"pushC64 1 iToF pushC64 0 iToF fDiv", 0, avm.DivisionByZero},
+		{"pushC64 -1 iToF fSqrt", 0, avm.InvalidOperands},
+		{"pushC64 1 iToF pushC64 3 iToF fDiv pushC64 0x100000000000 iToF fAdd", 0, avm.PrecisionLoss},
+		{"pushC64 0x7fefffffffffffff pushC64 2 iToF fMul", 0, avm.OverFlow},
+		{"pushC64 0x7fefffffffffffff pushC64 0x7fefffffffffffff fAdd", 0, avm.OverFlow},
+		{"pushC64 0x0010000000000000 pushC64 2 iToF fDiv", 0, avm.UnderFlow},
+		{"pushC64 0x0018000000000000 pushC64 0x0010000000000000 fSub", 0, avm.UnderFlow},
+		{"pushC64 0x7ff8000000000000 pushC64 2 iToF fAdd", 0, avm.InvalidOperands},
+		{"pushC64 0x7ff0000000000000 fNeg", 0, avm.InvalidOperands},
+		{"pushC64 0x7fffffffffffffff iToF", 0, avm.PrecisionLoss},
+		{"pushC64 0x7ffffffffffffc00 iToF", 0x7ffffffffffffc00, avm.NoError},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			if testCase.wantError == avm.NoError {
+				assert.Equal(t, math.Float64bits(testCase.wantValue), uint64(got), "invalid output")
+			}
+		})
+	}
+}
+
+func TestProcessor_FloatComparisonAndConversion(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{"pushC64 1 iToF pushC64 1 iToF fEq", 1, avm.NoError},
+		{"pushC64 0 iToF pushC64 0 iToF fNeg fEq", 1, avm.NoError},
+		{"pushC64 1 iToF pushC64 2 iToF fNe", 1, avm.NoError},
+		{"pushC64 -1 iToF pushC64 2 iToF fLt", 1, avm.NoError},
+		{"pushC64 2 iToF pushC64 2 iToF fLe", 1, avm.NoError},
+		{"pushC64 -1 iToF pushC64 2 iToF fGt", 0, avm.NoError},
+		{"pushC64 2 iToF pushC64 2 iToF fGe", 1, avm.NoError},
+		{"pushC64 7 iToF pushC64 2 iToF fDiv fToI", 3, avm.NoError},
+		{"pushC64 -7 iToF pushC64 2 iToF fDiv fToI", -3, avm.NoError},
+		{"pushC64 -9223372036854775808 iToF fToI", -9223372036854775808, avm.NoError},
+		{"pushC64 -9223372036854775808 iToF fNeg fToI", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 iToF pushC64 2 iToF fMul fToI", 0, avm.UnderFlow},
+		{"pushC64 0x7ff8000000000000 pushC64 0 fEq", 0, avm.InvalidOperands},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_Decimal(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{"pushC64 125 pushC64 3 dAddC8 1d2 1d0", 425, avm.NoError},
+		{"pushC64 3 pushC64 125 dAddC8 1d0 1d2", 425, avm.NoError},
+		{"pushC64 125 pushC64 3 dSubC8 1d2 1d0", -175, avm.NoError},
+		{"pushC64 0x7fffffffffffffff pushC64 1 dAddC8 1d0 1d0", 0, avm.OverFlow},
+		{"pushC64 0x7fffffffffffffff pushC64 1 dAddC8 1d0 1d1", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 pushC64 1 dSubC8 1d0 1d0", 0, avm.UnderFlow},
+		{"pushC64 150 pushC64 250 dMulC8 1d2 1d0", 375, avm.NoError},
+		{"pushC64 15 pushC64 25 dMulC8 1d2 1d0", 0, avm.PrecisionLoss},
+		{"pushC64 15 pushC64 25 dMulC8 1d2 1d1", 3, avm.NoError},
+		{"pushC64 15 pushC64 25 dMulC8 1d2 1d2", 4, avm.NoError},
+		{"pushC64 -15 pushC64 25 dMulC8 1d2 1d3", -4, avm.NoError},
+		{"pushC64 -15 pushC64 25 dMulC8 1d2 1d4", -3, avm.NoError},
+		{"pushC64 10 pushC64 25 dMulC8 1d2 1d5", 3, avm.NoError},
+		{"pushC64 10 pushC64 25 dMulC8 1d2 1d6", 2, avm.NoError},
+		{"pushC64 10 pushC64 35 dMulC8 1d2 1d6", 4, avm.NoError},
+		{"pushC64 10 pushC64 25 dMulC8 1d2 1d7", 0, avm.InvalidOperands},
+		{"pushC64 1 pushC64 1 dMulC8 1d19 1d1", 0, avm.InvalidOperands},
+		{"pushC64 4000000000000000000 pushC64 4000000000000000000 dMulC8 1d18 1d0",
+			0, avm.OverFlow},
+		{"pushC64 -4000000000000000000 pushC64 2000000000000000000 dMulC8 1d18 1d0",
+			-8000000000000000000, avm.NoError},
+		{"pushC64 100 pushC64 300 dDivC8 1d2 1d0", 0, avm.PrecisionLoss},
+		{"pushC64 100 pushC64 300 dDivC8 1d2 1d2", 34, avm.NoError},
+		{"pushC64 100 pushC64 300 dDivC8 1d2 1d6", 33, avm.NoError},
+		{"pushC64 -200 pushC64 300 dDivC8 1d2 1d6", -67, avm.NoError},
+		{"pushC64 100 pushC64 0 dDivC8 1d2 1d6", 0, avm.DivisionByZero},
+		{"pushC64 0x7fffffffffffffff pushC64 1 dDivC8 1d2 1d0", 0, avm.OverFlow},
+		{"pushC64 12345 dRescaleC8 1d3 1d1 1d0", 0, avm.PrecisionLoss},
+		{"pushC64 12345 dRescaleC8 1d3 1d1 1d6", 123, avm.NoError},
+		{"pushC64 12355 dRescaleC8 1d3 1d1 1d6", 124, avm.NoError},
+		{"pushC64 -12345 dRescaleC8 1d3 1d0 1d3", -13, avm.NoError},
+		{"pushC64 12 dRescaleC8 1d1 1d3 1d0", 1200, avm.NoError},
+		{"pushC64 -12 dRescaleC8 1d0 1d18 1d0", 0, avm.UnderFlow},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_Uint256(t *testing.T) {
+	const max = "pushC64 -1 i256FromI64 "
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{"pushC64 5 u256FromU64 pushC64 7 u256FromU64 u256Add u256ToU64", 12, avm.NoError},
+		{max + "pushC64 1 u256FromU64 u256Add u256IsZero", 1, avm.NoError},
+		{"pushC64 5 u256FromU64 pushC64 7 u256FromU64 u256Sub i256ToI64", -2, avm.NoError},
+		{"pushC64 5 u256FromU64 pushC64 7 u256FromU64 u256Sub u256ToU64", 0, avm.OverFlow},
+		{"pushC64 1 u256FromU64 pushC64 200 u256Shl pushC64 1 u256FromU64 pushC64 100 u256Shl " +
+			"u256Div pushC64 99 u256Shr u256ToU64", 2, avm.NoError},
+		{"pushC64 1 u256FromU64 pushC64 0 u256FromU64 u256Div", 0, avm.DivisionByZero},
+		{"pushC64 -7 i256FromI64 pushC64 2 i256FromI64 i256Div i256ToI64", -3, avm.NoError},
+		{"pushC64 -7 i256FromI64 pushC64 2 i256FromI64 i256Mod i256ToI64", -1, avm.NoError},
+		{"pushC64 1 u256FromU64 pushC64 255 u256Shl pushC64 -1 i256FromI64 i256Div", 0, avm.OverFlow},
+		{"pushC64 7 u256FromU64 pushC64 3 u256FromU64 u256Mod u256ToU64", 1, avm.NoError},
+		{max + max + "pushC64 7 u256FromU64 u256AddMod u256ToU64", 2, avm.NoError},
+		{max + max + "pushC64 7 u256FromU64 u256MulMod u256ToU64", 1, avm.NoError},
+		{max + max + "pushC64 0 u256FromU64 u256MulMod", 0, avm.DivisionByZero},
+		{"pushC64 3 u256FromU64 pushC64 5 u256FromU64 u256Exp u256ToU64", 243, avm.NoError},
+		{"pushC64 2 u256FromU64 pushC64 256 u256FromU64 u256Exp u256IsZero", 1, avm.NoError},
+		{max + "pushC64 1 u256FromU64 u256Lt", 0, avm.NoError},
+		{max + "pushC64 1 u256FromU64 i256Lt", 1, avm.NoError},
+		{max + "pushC64 1 u256FromU64 u256Gt", 1, avm.NoError},
+		{max + "pushC64 1 u256FromU64 i256Gt", 0, avm.NoError},
+		{max + "pushC64 -1 u256FromU64 u256Eq", 0, avm.NoError},
+		{max + "pushC64 0 u256FromU64 u256Not u256Eq", 1, avm.NoError},
+		{"pushC64 12 u256FromU64 pushC64 10 u256FromU64 u256And u256ToU64", 8, avm.NoError},
+		{"pushC64 12 u256FromU64 pushC64 10 u256FromU64 u256Or u256ToU64", 14, avm.NoError},
+		{"pushC64 12 u256FromU64 pushC64 10 u256FromU64 u256Xor u256ToU64", 6, avm.NoError},
+		{"pushC64 -16 i256FromI64 pushC64 2 i256Sar i256ToI64", -4, avm.NoError},
+		{"pushC64 -16 i256FromI64 pushC64 300 i256Sar i256ToI64", -1, avm.NoError},
+		{"pushC64 16 i256FromI64 i256Neg i256ToI64", -16, avm.NoError},
+		{"pushC64 -9223372036854775808 i256FromI64 i256Neg i256ToI64", 0, avm.OverFlow},
+		{"pushC64 -9223372036854775808 i256FromI64 pushC64 1 u256FromU64 u256Sub i256ToI64", 0, avm.UnderFlow},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_StackManipulation(t *testing.T) {
+	// every program pushes 1, 2, 3 and 4, and the result is built from the
+	// digits of the stack, from the top to the bottom, so the order of all
+	// the slots is checked.
+	const push = "pushC64 1 pushC64 2 pushC64 3 pushC64 4 "
+	const collect = " pushC64 10 iMul iAdd pushC64 10 iMul iAdd pushC64 10 iMul iAdd"
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{push + "pop" + " pushC64 10 iMul iAdd pushC64 10 iMul iAdd", 321, avm.NoError},
+		{push + "dup dropC8 1d1" + collect, 4321, avm.NoError},
+		{push + "dup iAdd" + collect, 8321, avm.NoError},
+		{push + "swap" + collect, 3421, avm.NoError},
+		{push + "over iAdd" + collect, 7321, avm.NoError},
+		{push + "rot" + collect, 2431, avm.NoError},
+		{push + "dupC8 1d2 iAdd iAdd" + collect, 11321, avm.NoError},
+		{push + "dupC8 1d0" + collect, 4321, avm.NoError},
+		{push + "swapC8 1d2" + collect, 2143, avm.NoError},
+		{push + "swapC8 1d1" + collect, 3421, avm.NoError},
+		{push + "dropC8 1d2 pushC64 3 pushC64 4" + collect, 4321, avm.NoError},
+		{push + "pickC16 2d0 iAdd" + collect, 8321, avm.NoError},
+		{push + "pickC16 2d3 iAdd" + collect, 5321, avm.NoError},
+		{push + "rollC16 2d3" + collect, 1432, avm.NoError},
+		{push + "rollC16 2d0" + collect, 4321, avm.NoError},
+		{push + "rollC16 2d1" + collect, 3421, avm.NoError},
+		{push + "rollC16 2d2" + collect, 2431, avm.NoError},
+		{"pop", 0, avm.StackUnderflow},
+		{"dup", 0, avm.StackUnderflow},
+		{"pushC64 1 swap", 0, avm.StackUnderflow},
+		{"pushC64 1 over", 0, avm.StackUnderflow},
+		{"pushC64 1 pushC64 2 rot", 0, avm.StackUnderflow},
+		{push + "dupC8 1d5", 0, avm.StackUnderflow},
+		{push + "swapC8 1d3", 0, avm.StackUnderflow},
+		{push + "dropC8 1d5", 0, avm.StackUnderflow},
+		{push + "pickC16 2d4", 0, avm.StackUnderflow},
+		{push + "rollC16 2d4", 0, avm.StackUnderflow},
+		{push + "rollC16 2d65535", 0, avm.StackUnderflow},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
+func TestProcessor_NarrowPushAndLocalFrame(t *testing.T) {
+	tests := []struct {
+		program   string
+		wantValue int64
+		wantError avm.ErrorCode
+	}{
+		{"pushC8 1d-2", -2, avm.NoError},
+		{"pushC16 2d-300", -300, avm.NoError},
+		{"pushC32 4d-70000", -70000, avm.NoError},
+		{"pushUC8 0xfe", 0xfe, avm.NoError},
+		{"pushUC16 0xfed4", 0xfed4, avm.NoError},
+		{"pushUC32 0xfffeee90", 0xfffeee90, avm.NoError},
+		{"pushC8 1d7 lfStoreC8 1d16 lfLoadC8 1d16", 7, avm.NoError},
+		{"pushC64 0x1122334455667788 lfStoreC16 2d8 lfLoad8C16 2d8", 0x88, avm.NoError},
+		{"pushC64 0x1122334455667788 lfStoreC16 2d8 lfLoad16C16 2d9", 0x6677, avm.NoError},
+		{"pushC64 0x1122334455667788 lfStoreC16 2d8 lfLoad32C16 2d12", 0x11223344, avm.NoError},
+		{"pushC64 -1 lfStoreC16 2d8 pushC64 0x1234 lfStore8C16 2d8 lfLoadC16 2d8", -0xcc, avm.NoError},
+		{"pushC64 -1 lfStoreC16 2d8 pushC64 0x1234 lfStore16C16 2d8 lfLoadC16 2d8", -0xedcc, avm.NoError},
+		{"pushC64 -1 lfStoreC16 2d8 pushC64 0 lfStore32C16 2d12 lfLoadC16 2d8", 0xffffffff, avm.NoError},
+		{"pushC64 0x1122334455667788 pushC8 1d24 lfStore pushC8 1d24 lfLoad", 0x1122334455667788, avm.NoError},
+		{"pushC64 0x1122334455667788 pushC8 1d24 lfStore pushC8 1d24 lfLoad8", 0x88, avm.NoError},
+		{"pushC64 0x1122334455667788 pushC8 1d24 lfStore pushC8 1d26 lfLoad16", 0x5566, avm.NoError},
+		{"pushC64 0x1122334455667788 pushC8 1d24 lfStore pushC8 1d28 lfLoad32", 0x11223344, avm.NoError},
+		{"pushC64 -1 pushC8 1d24 lfStore pushC8 1d0 pushC8 1d25 lfStore8 pushC8 1d24 lfLoad", -0xff01, avm.NoError},
+		{"pushC64 -1 pushC8 1d24 lfStore pushC8 1d0 pushC8 1d26 lfStore16 pushC8 1d24 lfLoad",
+			-0xffff0001, avm.NoError},
+		{"pushC64 -1 pushC8 1d24 lfStore pushC8 1d0 pushC8 1d24 lfStore32 pushC8 1d24 lfLoad",
+			-0x100000000, avm.NoError},
+		{"pushC8 1d-8 lfLoad", 0, avm.LocalFrameOutOfRange},
+		{"pushC8 1d0 pushC8 1d-8 lfStore", 0, avm.LocalFrameOutOfRange},
+		{"pushC64 0x7fffffffffffffff lfLoad8", 0, avm.LocalFrameOutOfRange},
+		{"pushC8 1d0 pushC64 0x7fffffffffffffff lfStore", 0, avm.LocalFrameOutOfRange},
+		{"lfLoad32C16 2d65534", 0, avm.LocalFrameOutOfRange},
+		{"pushC8 1d1 pushC32 4d262140 lfStore8 pushC32 4d262140 lfLoad8", 1, avm.NoError},
+		{"pushC8 1d1 pushC32 4d262141 lfStore32", 0, avm.LocalFrameOutOfRange},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.program, func(t *testing.T) {
+			got, gotError := runProgram(testCase.program + " ret64")
+			assert.Equal(t, testCase.wantError, gotError, "invalid error code")
+			assert.Equal(t, testCase.wantValue, got, "invalid output")
+		})
+	}
+}
+
 func BenchmarkFib(b *testing.B) {
 	n := 8
 	controller := avm.NewController()
 	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
 		17: {
-			0: assembler.AssembleString(""),
+			0: assembler.MustAssembleString(""),
 		},
 	})
 	arguments := []byte{byte(n), 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		controller.SetupNewSession(17, arguments, methodArea, methodArea)
+		controller.SetupNewSession(17, arguments, methodArea, methodArea, defaultGasLimit)
 		controller.Emulate()
 	}
 }
@@ -363,3 +1216,39 @@ func BenchmarkMemoryLoad(b *testing.B) {
 type tempInterface interface {
 	Load64(int64, []byte, int64)
 }
+
+func TestProcessor_ErrorInspection(t *testing.T) {
+	tests := []struct {
+		caller  string
+		callee  string
+		want    int64
+		wantErr avm.ErrorCode
+	}{
+		{"pushC64 0x12 indInvokeInternal errCode ret64", "ret0", 0, avm.NoError},
+		{"pushC64 0x12 indInvokeInternal errCode ret64", "pushC64 0 pushC64 0 iDiv ret64", int64(avm.DivisionByZero), avm.NoError},
+		{"pushC64 0x12 indInvokeInternal errCode ret64", "pushC64 0x00020b0a00000000 throw", int64(avm.SoftwareError), avm.NoError},
+		{"pushC64 0x12 indInvokeInternal errData ret64", "pushC64 0x00020b0a00000000 throw", 0x00020b0a00020b0a, avm.NoError},
+		{"pushC64 0x12 indInvokeInternal pushC64 -1 errData ret64", "pushC64 0 pushC64 0 iDiv ret64", 0x0000ffffffffffff, avm.NoError},
+		{"pushC64 0x12 indInvokeInternal pushC64 16 lfStoreErrData pushC64 16 lfLoad16 iAdd ret64",
+			"pushC64 0x00020b0a00000000 throw", 0x0b0c, avm.NoError},
+		{"pushC64 0x12 indInvokeInternal pushC64 16 lfStoreErrData ret64", "ret0", 0, avm.NoError},
+		{"pushC64 -1 lfStoreErrData ret64", "ret0", 0, avm.LocalFrameOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caller+" / "+tt.callee, func(t *testing.T) {
+			methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+				0x11: {
+					0:    assembler.MustAssembleString(tt.caller),
+					0x12: assembler.MustAssembleString(tt.callee),
+				},
+			})
+			controller := avm.NewController()
+			controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+			result := controller.Execute()
+			assert.Equal(t, tt.wantErr, result.Error)
+			if tt.wantErr == avm.NoError {
+				assert.Equal(t, tt.want, binary.ReadInt64(result.ReturnData, 0))
+			}
+		})
+	}
+}
@@ -50,16 +50,38 @@ func ReadUint16(src []byte, offset int64) uint16 {
 	return *(*uint16)(unsafe.Pointer(&src[offset]))
 }
 
+func ReadUint32(src []byte, offset int64) uint32 {
+	_ = src[offset+3]
+	return *(*uint32)(unsafe.Pointer(&src[offset]))
+}
+
 func ReadInt32(b []byte, offset int64) int32 {
 	_ = b[offset+3]
 	return *(*int32)(unsafe.Pointer(&b[offset]))
 }
 
-func readFloat64(b []byte, offset int64) float64 {
+func ReadFloat64(b []byte, offset int64) float64 {
 	_ = b[offset+7]
 	return *(*float64)(unsafe.Pointer(&b[offset]))
 }
 
+func PutFloat64(dst []byte, offset int64, v float64) {
+	_ = dst[offset+7]
+	*(*float64)(unsafe.Pointer(&dst[offset])) = v
+}
+
+// ReadUint256 reads a 256-bit integer which is stored as four 64-bit limbs,
+// from the least significant to the most significant.
+func ReadUint256(src []byte, offset int64) [4]uint64 {
+	_ = src[offset+31]
+	return *(*[4]uint64)(unsafe.Pointer(&src[offset]))
+}
+
+func PutUint256(dst []byte, offset int64, v [4]uint64) {
+	_ = dst[offset+31]
+	*(*[4]uint64)(unsafe.Pointer(&dst[offset])) = v
+}
+
 func ReadIdentifier64(src []byte, offset int64) prefix.Identifier64 {
 	_ = src[offset+7]
 	return *(*prefix.Identifier64)(unsafe.Pointer(&src[offset]))
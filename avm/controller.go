@@ -21,69 +21,107 @@ import (
 	"go-AVM/avm/memory"
 	"go-AVM/avm/prefix"
 	"log"
-	"reflect"
+	"sort"
 )
 
 type Opcode byte
 
 type Controller struct {
 	processor           Processor
-	instructionRoutines []func()
+	instructionRoutines [256]func(*Processor)
+	gasSchedule         *GasSchedule
 }
 
-// run this after changing instructionRoutines array
-//go:generate /bin/sh awk.sh
-
 func NewController() (c *Controller) {
-	c = &Controller{}
-	c.instructionRoutines = []func(){
-		0x00: c.processor.noOp,
-		0x01: c.processor.invokeDispatcher,
-		0x02: c.processor.indInvokeDispatcher,
-		0x03: c.processor.spawnDispatcher,
-		0x04: c.processor.invokeInternal,
-		0x05: c.processor.indInvokeInternal,
-		0x08: c.processor.ret0,
-		0x09: c.processor.ret64,
-		0x0b: c.processor.throw,
-		0x0c: c.processor.enter,
-		0x10: c.processor.pushC64,
-		0x11: c.processor.pop,
-		0x12: c.processor.iAdd,
-		0x13: c.processor.iSub,
-		0x14: c.processor.argC16,
-		0x15: c.processor.lfLoadC16,
-		0x16: c.processor.lfStoreC16,
-		0x17: c.processor.jmpEqC16,
+	c = &Controller{gasSchedule: DefaultGasSchedule()}
+	for i := range c.instructionRoutines {
+		c.instructionRoutines[i] = (*Processor).invalidOpcode
+	}
+	for _, ins := range instructionSet {
+		c.instructionRoutines[ins.opcode] = ins.routine
 	}
 	return
 }
 
+// SetGasSchedule sets the gas schedule of the sessions that will be set up
+// after calling this function.
+func (c *Controller) SetGasSchedule(s *GasSchedule) *Controller {
+	c.gasSchedule = s
+	return c
+}
+
+// SetupNewSession prepares the controller for executing the dispatcher of
+// `calledApp`. The session fails with OutOfGas if it needs more than
+// `gasLimit` gas.
 func (c *Controller) SetupNewSession(calledApp prefix.Identifier64, argumentBuffer []byte,
-	methodArea, heap *memory.Module) *Controller {
+	methodArea, heap *memory.Module, gasLimit uint64) *Controller {
+	gas := newGasMeter(gasLimit, c.gasSchedule)
 	c.processor = *newProcessor(&dynamicArray{
-		content: argumentBuffer,
-		maxSize: MaxLocalFrameSize,
-	}, heap, methodArea)
-	c.processor.callMethod(calledApp, calledApp, DispatcherID)
-	c.processor.current.isIndependent = true
-	c.processor.heap.Save()
+		content:    argumentBuffer,
+		maxSize:    MaxLocalFrameSize,
+		paidLen:    InitialLocalFrameSize,
+		gas:        gas,
+		limitError: LocalFrameOutOfRange,
+	}, heap, methodArea, gas)
+	if _, err := methodArea.Fetch(calledApp, DispatcherID); err != nil {
+		log.Println("avm: storage error:", err)
+		c.processor.callStackQueue = nil
+		c.processor.errorStatus = StorageError
+		return c
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.handlePanic(r)
+		}
+	}()
+	c.processor.callMethod(calledApp, calledApp, DispatcherID, true)
 	return c
 }
 
+// Emulate runs the session until it ends and returns its return data and
+// error code. Use Execute for getting the detailed result of the session.
 func (c *Controller) Emulate() ([]byte, ErrorCode) {
+	r := c.Execute()
+	return r.ReturnData, r.Error
+}
+
+// Execute runs the session until it ends and returns its result.
+func (c *Controller) Execute() *Result {
 	eof := false
 	for !eof {
 		eof = c.EmulateNextInstruction()
 	}
-	return c.processor.returnData, c.processor.errorStatus
+	return c.Result()
+}
+
+// Result returns the result of the session. If the session has not ended,
+// the returned result reflects the current state of the session.
+func (c *Controller) Result() *Result {
+	p := &c.processor
+	r := &Result{
+		ReturnData:       p.returnData,
+		Error:            p.errorStatus,
+		GasUsed:          c.GasUsed(),
+		InstructionCount: p.instructionCount,
+		Events:           p.events,
+	}
+	if r.Error != NoError {
+		r.Failure = p.failure
+	}
+	for id := range p.touched {
+		r.TouchedChunks = append(r.TouchedChunks, id)
+	}
+	sort.Slice(r.TouchedChunks, func(i, j int) bool {
+		a, b := r.TouchedChunks[i], r.TouchedChunks[j]
+		return a.Root < b.Root || a.Root == b.Root && a.Child < b.Child
+	})
+	return r
 }
 
 func (c *Controller) EmulateNextInstruction() (eof bool) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("panic:", r)
-			c.processor.throwBytes(0, convertToErrorCode(r))
+			c.handlePanic(r)
 			eof = false
 		}
 	}()
@@ -91,17 +129,29 @@ func (c *Controller) EmulateNextInstruction() (eof bool) {
 	if eof {
 		return true
 	}
-	c.instructionRoutines[opcode]()
+	c.processor.instructionCount++
+	c.processor.gas.consume(c.processor.gas.schedule.Instructions[opcode])
+	c.instructionRoutines[opcode](&c.processor)
 	return false
 }
 
-func convertToErrorCode(r interface{}) ErrorCode {
-	switch reflect.TypeOf(r).String() {
-	case "runtime.boundsError":
-		return InvalidReference
-	case "avm.ErrorCode":
-		return r.(ErrorCode)
-	default:
-		return RuntimeError
+// handlePanic ends the current call of the session with the error that is
+// raised by a panic.
+func (c *Controller) handlePanic(r interface{}) {
+	if code, ok := r.(ErrorCode); ok {
+		c.processor.throwBytes(0, code)
+	} else if failure, ok := r.(storeFailure); ok {
+		log.Println("avm: storage error:", failure.err)
+		c.processor.abort(StorageError)
+	} else {
+		// any other panic is a bug of the AVM, and we must not let
+		// applications handle it like their own errors.
+		log.Println("avm: internal error:", r)
+		c.processor.abort(InternalError)
 	}
 }
+
+// GasUsed returns the amount of gas used by the current session.
+func (c *Controller) GasUsed() uint64 {
+	return c.processor.gasLimit - c.processor.gas.remaining
+}
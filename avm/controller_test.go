@@ -0,0 +1,111 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go-AVM/avm/memory"
+	"go-AVM/avm/prefix"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestController_InternalError(t *testing.T) {
+	heap := memory.NewMocker(nil)
+	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		// pushC64 0x12 indInvokeInternal ret0
+		0x11: {
+			0:    []byte{0x10, 0x12, 0, 0, 0, 0, 0, 0, 0, 0x05, 0x08},
+			0x12: {0xfe},
+		},
+	})
+	c := NewController()
+	c.instructionRoutines[0xfe] = func(p *Processor) {
+		var s []byte
+		// an AVM bug: indexing out of range
+		_ = s[p.current.pc]
+	}
+	c.SetupNewSession(0x11, nil, methodArea, heap, 1000000)
+	output, err := c.Emulate()
+	assert.Equal(t, InternalError, err, "internal errors must not be caught by applications")
+	assert.Nil(t, output)
+	assert.Equal(t, "root<-11   Save   root<-11   Save   Restore   Restore", heap.AccessLog())
+	assert.Equal(t, &Failure{App: 0x11, Method: 0x12, PC: 0, CallDepth: 2}, c.Result().Failure)
+	assert.NoError(t, heap.Commit())
+
+	// the session must be aborted even when the checkpoints are inconsistent
+	heap = memory.NewMocker(nil)
+	c.SetupNewSession(0x11, nil, methodArea, heap, 1000000)
+	c.processor.discard()
+	assert.NotPanics(t, func() { _, err = c.Emulate() })
+	assert.Equal(t, InternalError, err)
+	assert.Nil(t, c.processor.current)
+	assert.Equal(t, memory.ErrPoisoned, heap.Commit(), "changes that are not reverted must not be committed")
+
+	heap = memory.NewMocker(nil)
+	c.SetupNewSession(0x11, nil, methodArea, heap, 1000000)
+	c.processor.heap.Discard()
+	assert.NotPanics(t, func() { _, err = c.Emulate() })
+	assert.Equal(t, InternalError, err)
+	assert.Nil(t, c.processor.current)
+	assert.Equal(t, memory.ErrPoisoned, heap.Commit())
+}
+
+func TestDefaultGasSchedule(t *testing.T) {
+	names := map[string]bool{}
+	for _, ins := range instructionSet {
+		names[ins.name] = true
+	}
+	for name := range defaultInstructionCosts {
+		assert.True(t, names[name], "unknown instruction: %s", name)
+	}
+	s := DefaultGasSchedule()
+	assert.Equal(t, uint64(60), s.Instructions[0x03], "spawnDispatcher")
+	assert.Equal(t, uint64(2), s.Instructions[0x07], "errCode")
+}
+
+func TestInstructions(t *testing.T) {
+	operandFormat := regexp.MustCompile(`^([iub](8|16|32|64)|o(16|32))\*?$`)
+	names := map[string]bool{}
+	opcodes := map[Opcode]bool{}
+	for _, ins := range instructionSet {
+		assert.False(t, names[ins.name], "duplicate name: %s", ins.name)
+		assert.False(t, opcodes[ins.opcode], "duplicate opcode: %#02x", ins.opcode)
+		assert.NotNil(t, ins.routine, ins.name)
+		names[ins.name] = true
+		opcodes[ins.opcode] = true
+		for _, f := range strings.Fields(ins.operands) {
+			assert.Regexp(t, operandFormat, f, "invalid operand format of %s", ins.name)
+		}
+	}
+
+	list := Instructions()
+	assert.Len(t, list, len(instructionSet))
+	for i := 1; i < len(list); i++ {
+		assert.Less(t, list[i-1].Opcode, list[i].Opcode)
+	}
+	assert.Contains(t, list, InstructionInfo{0x81, "jmpTable", "u16 o32 o32*"})
+
+	c := NewController()
+	for opcode := 0; opcode < 256; opcode++ {
+		if !opcodes[Opcode(opcode)] {
+			assert.PanicsWithValue(t, InvalidOpcode, func() { c.instructionRoutines[opcode](&c.processor) })
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import "math/bits"
+
+// Decimal numbers are represented by signed 64-bit integers which are scaled
+// by a power of ten: a decimal with the scale `s` and the integer value `v`
+// represents v/10^s. The scale is not stored with the number and is given to
+// decimal instructions as an immediate operand. The maximum scale is
+// MaxDecimalScale.
+//
+// Decimal instructions never round silently: when a result is inexact, it is
+// rounded according to the RoundingMode of the instruction. The RoundExact
+// mode raises PrecisionLoss instead of rounding. Like checked integer
+// instructions, results that are too big raise OverFlow and results that
+// are too small (negative) raise UnderFlow.
+
+const MaxDecimalScale = 18
+
+type RoundingMode byte
+
+const (
+	RoundExact RoundingMode = iota
+	RoundDown
+	RoundUp
+	RoundFloor
+	RoundCeiling
+	RoundHalfUp
+	RoundHalfEven
+)
+
+var pow10 = [MaxDecimalScale + 1]uint64{
+	1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18,
+}
+
+func scaleFactor(scale byte) uint64 {
+	if scale > MaxDecimalScale {
+		panic(InvalidOperands)
+	}
+	return pow10[scale]
+}
+
+// decimalAdd adds `b` with the scale `sb` to `a` with the scale `sa`. The
+// scale of the result is the greater one of `sa` and `sb`.
+func decimalAdd(b int64, sb byte, a int64, sa byte) int64 {
+	b, a = alignScales(b, sb, a, sa)
+	r := b + a
+	if a > 0 && r < b {
+		panic(OverFlow)
+	}
+	if a < 0 && r > b {
+		panic(UnderFlow)
+	}
+	return r
+}
+
+func decimalSub(b int64, sb byte, a int64, sa byte) int64 {
+	b, a = alignScales(b, sb, a, sa)
+	r := b - a
+	if a < 0 && r < b {
+		panic(OverFlow)
+	}
+	if a > 0 && r > b {
+		panic(UnderFlow)
+	}
+	return r
+}
+
+func alignScales(b int64, sb byte, a int64, sa byte) (int64, int64) {
+	if sb < sa {
+		return decimalRescale(b, sb, sa, RoundExact), a
+	}
+	return b, decimalRescale(a, sa, sb, RoundExact)
+}
+
+// decimalMul multiplies two decimals with the same scale.
+func decimalMul(b, a int64, scale byte, mode RoundingMode) int64 {
+	neg := (a < 0) != (b < 0)
+	hi, lo := bits.Mul64(abs64(b), abs64(a))
+	return divideRounded(neg, hi, lo, scaleFactor(scale), mode)
+}
+
+// decimalDiv divides `b` by `a`. Both decimals and the result have the same
+// scale.
+func decimalDiv(b, a int64, scale byte, mode RoundingMode) int64 {
+	if a == 0 {
+		panic(DivisionByZero)
+	}
+	neg := (a < 0) != (b < 0)
+	hi, lo := bits.Mul64(abs64(b), scaleFactor(scale))
+	return divideRounded(neg, hi, lo, abs64(a), mode)
+}
+
+// decimalRescale changes the scale of a decimal from `from` to `to`.
+func decimalRescale(v int64, from, to byte, mode RoundingMode) int64 {
+	neg := v < 0
+	if from > to {
+		return divideRounded(neg, 0, abs64(v), scaleFactor(from-to), mode)
+	}
+	hi, lo := bits.Mul64(abs64(v), scaleFactor(to-from))
+	if hi != 0 {
+		overflow(neg)
+	}
+	return applySign(neg, lo)
+}
+
+// divideRounded divides the 128-bit magnitude hi:lo by `d` and rounds the
+// quotient using `mode`. `neg` determines the sign of the result.
+func divideRounded(neg bool, hi, lo, d uint64, mode RoundingMode) int64 {
+	if hi >= d {
+		overflow(neg)
+	}
+	q, r := bits.Div64(hi, lo, d)
+	increment := false
+	switch mode {
+	case RoundExact:
+		if r != 0 {
+			panic(PrecisionLoss)
+		}
+	case RoundDown:
+	case RoundUp:
+		increment = r != 0
+	case RoundFloor:
+		increment = r != 0 && neg
+	case RoundCeiling:
+		increment = r != 0 && !neg
+	case RoundHalfUp:
+		increment = r != 0 && r >= d-r
+	case RoundHalfEven:
+		increment = r != 0 && (r > d-r || r == d-r && q&1 == 1)
+	default:
+		panic(InvalidOperands)
+	}
+	if increment {
+		var carry uint64
+		q, carry = bits.Add64(q, 1, 0)
+		if carry != 0 {
+			overflow(neg)
+		}
+	}
+	return applySign(neg, q)
+}
+
+func applySign(neg bool, magnitude uint64) int64 {
+	if neg {
+		if magnitude > 1<<63 {
+			panic(UnderFlow)
+		}
+		return int64(-magnitude)
+	}
+	if magnitude > 1<<63-1 {
+		panic(OverFlow)
+	}
+	return int64(magnitude)
+}
+
+func overflow(neg bool) {
+	if neg {
+		panic(UnderFlow)
+	}
+	panic(OverFlow)
+}
+
+func abs64(v int64) uint64 {
+	if v < 0 {
+		return -uint64(v)
+	}
+	return uint64(v)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import "strconv"
+
+// ErrorCode is the error status of a call or a session.
+//
+// The numeric values of error codes are part of the AVM's external
+// interface: a value is never changed or reused once assigned, and new codes
+// are only added at the end. Clients may safely decode an error code from
+// its integer value.
+//
+// SoftwareError is the only error that is raised by applications, using the
+// throw instruction. All other non-zero codes are raised by the AVM itself
+// when an instruction can not be executed (see IsVMError).
+type ErrorCode int
+
+const (
+	NoError                   ErrorCode = 0
+	InvalidOperands           ErrorCode = 1
+	InvalidSpawnState         ErrorCode = 2
+	SoftwareError             ErrorCode = 3
+	InvalidReference          ErrorCode = 4
+	MemoryLimitExceeded       ErrorCode = 5
+	MaxCallStackDepthExceeded ErrorCode = 6
+	OverFlow                  ErrorCode = 7
+	UnderFlow                 ErrorCode = 8
+	PrecisionLoss             ErrorCode = 9
+	Reentrancy                ErrorCode = 10
+	RuntimeError              ErrorCode = 11
+	OutOfGas                  ErrorCode = 12
+	DivisionByZero            ErrorCode = 13
+	StackUnderflow            ErrorCode = 14
+	StackOverflow             ErrorCode = 15
+	LocalFrameOutOfRange      ErrorCode = 16
+	PcOutOfRange              ErrorCode = 17
+	InvalidOpcode             ErrorCode = 18
+	// InternalError indicates a bug in the AVM. It can not be caught by
+	// applications and terminates the session.
+	InternalError ErrorCode = 19
+	// StorageError indicates that the chunk store failed. Like InternalError,
+	// it can not be caught by applications and terminates the session.
+	StorageError ErrorCode = 20
+)
+
+var errorNames = [...]string{
+	NoError:                   "NoError",
+	InvalidOperands:           "InvalidOperands",
+	InvalidSpawnState:         "InvalidSpawnState",
+	SoftwareError:             "SoftwareError",
+	InvalidReference:          "InvalidReference",
+	MemoryLimitExceeded:       "MemoryLimitExceeded",
+	MaxCallStackDepthExceeded: "MaxCallStackDepthExceeded",
+	OverFlow:                  "OverFlow",
+	UnderFlow:                 "UnderFlow",
+	PrecisionLoss:             "PrecisionLoss",
+	Reentrancy:                "Reentrancy",
+	RuntimeError:              "RuntimeError",
+	OutOfGas:                  "OutOfGas",
+	DivisionByZero:            "DivisionByZero",
+	StackUnderflow:            "StackUnderflow",
+	StackOverflow:             "StackOverflow",
+	LocalFrameOutOfRange:      "LocalFrameOutOfRange",
+	PcOutOfRange:              "PcOutOfRange",
+	InvalidOpcode:             "InvalidOpcode",
+	InternalError:             "InternalError",
+	StorageError:              "StorageError",
+}
+
+// String returns the name of the error code. Undefined codes are printed as
+// ErrorCode(n).
+func (e ErrorCode) String() string {
+	if e >= 0 && int(e) < len(errorNames) {
+		return errorNames[e]
+	}
+	return "ErrorCode(" + strconv.Itoa(int(e)) + ")"
+}
+
+// Error implements the error interface, so error codes can be wrapped and
+// compared using errors.Is.
+func (e ErrorCode) Error() string {
+	return "avm: " + e.String()
+}
+
+// IsVMError reports whether the error is raised by the AVM, as opposed to
+// SoftwareError which is thrown by applications.
+func (e ErrorCode) IsVMError() bool {
+	return e != NoError && e != SoftwareError
+}
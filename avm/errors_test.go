@@ -0,0 +1,78 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go-AVM/avm"
+	"testing"
+)
+
+func TestErrorCode_Encoding(t *testing.T) {
+	// these values are part of the external interface and must never change
+	tests := []struct {
+		code  avm.ErrorCode
+		value int
+		name  string
+	}{
+		{avm.NoError, 0, "NoError"},
+		{avm.InvalidOperands, 1, "InvalidOperands"},
+		{avm.InvalidSpawnState, 2, "InvalidSpawnState"},
+		{avm.SoftwareError, 3, "SoftwareError"},
+		{avm.InvalidReference, 4, "InvalidReference"},
+		{avm.MemoryLimitExceeded, 5, "MemoryLimitExceeded"},
+		{avm.MaxCallStackDepthExceeded, 6, "MaxCallStackDepthExceeded"},
+		{avm.OverFlow, 7, "OverFlow"},
+		{avm.UnderFlow, 8, "UnderFlow"},
+		{avm.PrecisionLoss, 9, "PrecisionLoss"},
+		{avm.Reentrancy, 10, "Reentrancy"},
+		{avm.RuntimeError, 11, "RuntimeError"},
+		{avm.OutOfGas, 12, "OutOfGas"},
+		{avm.DivisionByZero, 13, "DivisionByZero"},
+		{avm.StackUnderflow, 14, "StackUnderflow"},
+		{avm.StackOverflow, 15, "StackOverflow"},
+		{avm.LocalFrameOutOfRange, 16, "LocalFrameOutOfRange"},
+		{avm.PcOutOfRange, 17, "PcOutOfRange"},
+		{avm.InvalidOpcode, 18, "InvalidOpcode"},
+		{avm.InternalError, 19, "InternalError"},
+		{avm.StorageError, 20, "StorageError"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.value, int(tt.code))
+			assert.Equal(t, tt.name, tt.code.String())
+			assert.Equal(t, "avm: "+tt.name, tt.code.Error())
+			assert.Equal(t, tt.code != avm.NoError && tt.code != avm.SoftwareError, tt.code.IsVMError())
+		})
+	}
+	assert.Equal(t, "ErrorCode(100)", avm.ErrorCode(100).String())
+	assert.Equal(t, "ErrorCode(-1)", avm.ErrorCode(-1).String())
+}
+
+func TestErrorCode_ErrorsIs(t *testing.T) {
+	var err error = avm.OutOfGas
+	wrapped := fmt.Errorf("session failed: %w", err)
+	assert.True(t, errors.Is(wrapped, avm.OutOfGas))
+	assert.False(t, errors.Is(wrapped, avm.SoftwareError))
+
+	var code avm.ErrorCode
+	assert.True(t, errors.As(wrapped, &code))
+	assert.Equal(t, avm.OutOfGas, code)
+}
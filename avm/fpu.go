@@ -18,42 +18,171 @@
 package avm
 
 import (
-	"fmt"
 	"math"
+	"math/bits"
 )
 
+// MaxAdditionLoss is the maximum value of the part of the significand of
+// the smaller operand of an addition which is discarded because of the
+// difference between the exponents of the operands. An addition that loses
+// more than this value raises PrecisionLoss. Programs can use fTruncC8 to
+// explicitly drop the low order bits of an operand before an addition.
 const MaxAdditionLoss = 0x100000
 
-func add(a, b uint64) float64 {
-	e1 := extractExp(a)
-	e2 := extractExp(b)
+const (
+	significandBits = 52
+	significandMask = 1<<significandBits - 1
+	minNormal       = 0x1p-1022
+)
+
+// The AVM only accepts finite floating point numbers. The operations of
+// this file never produce NaN or infinity: an infinite result raises
+// OverFlow and a result that is smaller than the smallest normal number
+// raises UnderFlow.
+//
+// All operations are correctly rounded IEEE 754 operations in the
+// round-to-nearest-even mode. The explicit float64 conversions prevent the
+// compiler from fusing operations (e.g. into an FMA instruction), so the
+// results are bit-identical on all architectures.
+
+func checkFloat(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		panic(InvalidOperands)
+	}
+	return f
+}
+
+func checkFloatResult(r float64) float64 {
+	if math.IsInf(r, 0) {
+		panic(OverFlow)
+	}
+	return r
+}
+
+func fpAdd(a, b float64) float64 {
+	checkAdditionLoss(math.Float64bits(a), math.Float64bits(b))
+	return checkSubnormal(checkFloatResult(float64(a + b)))
+}
 
-	if e1 > e2 {
-		fmt.Printf("%v %v %v %b ", e1, e2, e1-e2, (uint64(math.MaxUint64)>>(64-e1+e2))&b)
-		if (math.MaxUint64>>(64-e1+e2))&b > MaxAdditionLoss {
-			panic("under")
-		}
-	} else if e2 < e1 {
-		if (math.MaxUint64>>(64-e2+e1))&a > MaxAdditionLoss {
-			panic("under")
-		}
+func fpSub(a, b float64) float64 {
+	checkAdditionLoss(math.Float64bits(a), math.Float64bits(b))
+	return checkSubnormal(checkFloatResult(float64(a - b)))
+}
+
+// checkSubnormal raises UnderFlow for a nonzero result of an addition that
+// is smaller than the smallest normal number. Such results are exact, but
+// they are rejected to be consistent with the other operations.
+func checkSubnormal(r float64) float64 {
+	if r != 0 && math.Abs(r) < minNormal {
+		panic(UnderFlow)
+	}
+	return r
+}
+
+func fpMul(a, b float64) float64 {
+	r := checkFloatResult(float64(a * b))
+	if a != 0 && b != 0 && math.Abs(r) < minNormal {
+		panic(UnderFlow)
 	}
-	return math.Float64frombits(a) + math.Float64frombits(b)
+	return r
 }
 
+func fpDiv(a, b float64) float64 {
+	if b == 0 {
+		panic(DivisionByZero)
+	}
+	r := checkFloatResult(float64(a / b))
+	if a != 0 && math.Abs(r) < minNormal {
+		panic(UnderFlow)
+	}
+	return r
+}
+
+func fpSqrt(a float64) float64 {
+	if a < 0 {
+		panic(InvalidOperands)
+	}
+	return math.Sqrt(a)
+}
+
+// intToFloat converts a signed integer to a float. The conversion raises
+// PrecisionLoss if the integer can not be represented exactly.
+func intToFloat(v int64) float64 {
+	abs := uint64(v)
+	if v < 0 {
+		abs = -abs
+	}
+	if bits.Len64(abs)-bits.TrailingZeros64(abs) > significandBits+1 {
+		panic(PrecisionLoss)
+	}
+	return float64(v)
+}
+
+// floatToInt converts a float to a signed integer by truncating its
+// fractional part. Like integer instructions, values greater than the
+// maximum int64 raise OverFlow and values less than the minimum int64 raise
+// UnderFlow.
+func floatToInt(f float64) int64 {
+	if f >= 0x1p63 {
+		panic(OverFlow)
+	}
+	if f < -0x1p63 {
+		panic(UnderFlow)
+	}
+	return int64(f)
+}
+
+// checkAdditionLoss raises PrecisionLoss when adding (or subtracting) two
+// floats discards a part of the significand of the smaller operand which is
+// greater than MaxAdditionLoss.
+func checkAdditionLoss(a, b uint64) {
+	if a<<1 == 0 || b<<1 == 0 {
+		return
+	}
+	e1 := effectiveExp(a)
+	e2 := effectiveExp(b)
+	if e1 < e2 {
+		e1, e2 = e2, e1
+		b = a
+	}
+	lost := significand(b)
+	if shift := e1 - e2; shift < 64 {
+		lost &= 1<<shift - 1
+	}
+	if lost > MaxAdditionLoss {
+		panic(PrecisionLoss)
+	}
+}
+
+// truncate drops all the fractional bits of `f` except the first `n` ones.
+// The result is rounded toward zero.
 func truncate(f uint64, n int) uint64 {
-	shift := (52 + 1023) - (int(extractExp(f)) + n)
-	fmt.Printf("sh:%v ", shift)
+	shift := (significandBits + 1023) - (int(extractExp(f)) + n)
 	if shift <= 0 {
 		return f
 	}
-	if shift > 52 {
-		return 0
+	if shift > significandBits {
+		return f & (1 << 63)
 	}
-	fmt.Printf("%b", uint(math.MaxUint64<<shift))
 	return f & (math.MaxUint64 << shift)
 }
 
 func extractExp(f uint64) uint64 {
-	return f >> 52 & 0x7ff
+	return f >> significandBits & 0x7ff
+}
+
+// effectiveExp returns the biased exponent of `f`. Subnormal numbers have
+// the same exponent as the smallest normal number.
+func effectiveExp(f uint64) uint64 {
+	if e := extractExp(f); e != 0 {
+		return e
+	}
+	return 1
+}
+
+func significand(f uint64) uint64 {
+	if extractExp(f) == 0 {
+		return f & significandMask
+	}
+	return f&significandMask | 1<<significandBits
 }
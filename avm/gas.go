@@ -0,0 +1,295 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// GasSchedule determines the gas cost of executing a program.
+//
+// Every instruction has a base cost that is charged before the instruction
+// is executed. Growing the operand stack or the local frame of a call beyond
+// its initial size costs MemoryByte for every extra byte. Loading a heap or
+// a method area chunk costs ChunkLoad plus ChunkByte for every byte of the
+// chunk. The method area chunk of the first method of a session is not
+// charged.
+type GasSchedule struct {
+	Instructions [256]uint64
+	MemoryByte   uint64
+	ChunkLoad    uint64
+	ChunkByte    uint64
+}
+
+// defaultInstructionCosts contains the costs of the default schedule that
+// are different from its base instruction cost. Instructions are identified
+// by their names, so the costs do not depend on the opcode assignment.
+var defaultInstructionCosts = map[string]uint64{
+	"noOp":                1,
+	"invokeDispatcher":    40,
+	"indInvokeDispatcher": 60,
+	"spawnDispatcher":     60,
+	"invokeInternal":      20,
+	"indInvokeInternal":   40,
+	"emitC16":             20,
+	"ret0":                5,
+	"ret64":               5,
+	"errData":             5,
+	"throw":               10,
+	"enter":               10,
+	"lfStoreErrData":      5,
+	"hLoadLocal":          5,
+	"hLoad8":              4,
+	"hLoad16":             4,
+	"hLoad32":             4,
+	"hLoad64":             4,
+	"hStore8":             8,
+	"hStore16":            8,
+	"hStore32":            8,
+	"hStore64":            8,
+	"hLoadBytesC16":       10,
+	"hStoreBytesC16":      20,
+	"iMul":                3,
+	"iDiv":                5,
+	"iRem":                5,
+	"uDiv":                5,
+	"uRem":                5,
+	"iMulChk":             3,
+	"uMulChk":             3,
+	"jmpTable":            4,
+	"fAdd":                3,
+	"fSub":                3,
+	"fMul":                4,
+	"fDiv":                6,
+	"fSqrt":               8,
+	"dMulC8":              5,
+	"dDivC8":              6,
+	"dRescaleC8":          4,
+	"u256Add":             4,
+	"u256Sub":             4,
+	"u256Mul":             10,
+	"u256Div":             20,
+	"u256Mod":             20,
+	"i256Div":             20,
+	"i256Mod":             20,
+	"u256AddMod":          24,
+	"u256MulMod":          40,
+	"u256Exp":             60,
+}
+
+// DefaultGasSchedule returns the gas schedule that is used when no schedule
+// is set for a Controller.
+func DefaultGasSchedule() *GasSchedule {
+	s := &GasSchedule{
+		MemoryByte: 1,
+		ChunkLoad:  100,
+		ChunkByte:  1,
+	}
+	for i := range s.Instructions {
+		s.Instructions[i] = 2
+	}
+	for _, ins := range instructionSet {
+		if cost, ok := defaultInstructionCosts[ins.name]; ok {
+			s.Instructions[ins.opcode] = cost
+		}
+	}
+	return s
+}
+
+// GasScheduleSet is a set of gas schedules, each with an activation
+// version. A session must use the schedule with the greatest activation
+// version that is not greater than the version of the session. This way
+// old sessions can be replayed under the schedule they originally ran with.
+//
+// A GasScheduleSet is loaded from a JSON file:
+//		{
+//		  "schedules": [
+//		    {
+//		      "activation": 0,
+//		      "defaultInstructionCost": 2,
+//		      "instructions": {"0x01": 40, "0x04": 20},
+//		      "memoryByte": 1,
+//		      "chunkLoad": 100,
+//		      "chunkByte": 1
+//		    },
+//		    {
+//		      "activation": 1200,
+//		      "instructions": {"0x04": 25}
+//		    }
+//		  ]
+//		}
+// The first schedule must define all the costs. Every other schedule only
+// contains the costs that are changed relative to the previous schedule.
+// The defaultInstructionCost of a later schedule only applies to the
+// instructions whose cost has never been given explicitly. Instructions are
+// identified by their opcodes. All instruction costs must
+// be greater than zero.
+type GasScheduleSet struct {
+	activations []uint64
+	schedules   []*GasSchedule
+}
+
+type gasScheduleFile struct {
+	Schedules []struct {
+		Activation             *uint64           `json:"activation"`
+		DefaultInstructionCost *uint64           `json:"defaultInstructionCost"`
+		Instructions           map[string]uint64 `json:"instructions"`
+		MemoryByte             *uint64           `json:"memoryByte"`
+		ChunkLoad              *uint64           `json:"chunkLoad"`
+		ChunkByte              *uint64           `json:"chunkByte"`
+	} `json:"schedules"`
+}
+
+var ErrNoGasSchedule = errors.New("avm: no gas schedule is active for the version")
+
+// LoadGasSchedules reads a GasScheduleSet from a JSON file.
+func LoadGasSchedules(path string) (*GasScheduleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGasSchedules(data)
+}
+
+// ParseGasSchedules parses the JSON representation of a GasScheduleSet.
+func ParseGasSchedules(data []byte) (*GasScheduleSet, error) {
+	var file gasScheduleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("avm: invalid gas schedule file: %w", err)
+	}
+	if len(file.Schedules) == 0 {
+		return nil, errors.New("avm: gas schedule file contains no schedules")
+	}
+	set := &GasScheduleSet{}
+	var explicit [256]bool
+	for i, entry := range file.Schedules {
+		if entry.Activation == nil {
+			return nil, fmt.Errorf("avm: gas schedule %d: missing activation version", i)
+		}
+		if i > 0 && *entry.Activation <= set.activations[i-1] {
+			return nil, fmt.Errorf("avm: gas schedule %d: activation versions must be increasing", i)
+		}
+		s := &GasSchedule{}
+		if i == 0 {
+			if entry.DefaultInstructionCost == nil || entry.MemoryByte == nil ||
+				entry.ChunkLoad == nil || entry.ChunkByte == nil {
+				return nil, errors.New("avm: gas schedule 0: all costs must be defined")
+			}
+		} else {
+			*s = *set.schedules[i-1]
+		}
+		if entry.DefaultInstructionCost != nil {
+			for opcode := range s.Instructions {
+				if !explicit[opcode] {
+					s.Instructions[opcode] = *entry.DefaultInstructionCost
+				}
+			}
+		}
+		for key, cost := range entry.Instructions {
+			opcode, err := strconv.ParseUint(key, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("avm: gas schedule %d: invalid opcode %q", i, key)
+			}
+			s.Instructions[opcode] = cost
+			explicit[opcode] = true
+		}
+		for opcode, cost := range s.Instructions {
+			if cost == 0 {
+				return nil, fmt.Errorf("avm: gas schedule %d: the cost of opcode %#02x is zero", i, opcode)
+			}
+		}
+		if entry.MemoryByte != nil {
+			s.MemoryByte = *entry.MemoryByte
+		}
+		if entry.ChunkLoad != nil {
+			s.ChunkLoad = *entry.ChunkLoad
+		}
+		if entry.ChunkByte != nil {
+			s.ChunkByte = *entry.ChunkByte
+		}
+		set.activations = append(set.activations, *entry.Activation)
+		set.schedules = append(set.schedules, s)
+	}
+	return set, nil
+}
+
+// At returns the schedule that is active at `version`. The returned schedule
+// must not be modified.
+func (set *GasScheduleSet) At(version uint64) (*GasSchedule, error) {
+	i := sort.Search(len(set.activations), func(i int) bool { return set.activations[i] > version })
+	if i == 0 {
+		return nil, ErrNoGasSchedule
+	}
+	return set.schedules[i-1], nil
+}
+
+type gasMeter struct {
+	remaining uint64
+	schedule  *GasSchedule
+}
+
+func newGasMeter(limit uint64, schedule *GasSchedule) *gasMeter {
+	return &gasMeter{
+		remaining: limit,
+		schedule:  schedule,
+	}
+}
+
+// consume panics with OutOfGas when there is not enough gas. In that case
+// all the remaining gas is consumed.
+func (g *gasMeter) consume(amount uint64) {
+	if amount > g.remaining {
+		g.remaining = 0
+		panic(OutOfGas)
+	}
+	g.remaining -= amount
+}
+
+func (g *gasMeter) consumeMemory(bytes int64) {
+	g.consume(mulGas(uint64(bytes), g.schedule.MemoryByte))
+}
+
+func (g *gasMeter) consumeChunk(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	g.consume(addGas(g.schedule.ChunkLoad, mulGas(uint64(size), g.schedule.ChunkByte)))
+}
+
+func mulGas(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi != 0 {
+		return math.MaxUint64
+	}
+	return lo
+}
+
+func addGas(a, b uint64) uint64 {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return math.MaxUint64
+	}
+	return sum
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-AVM/assembler"
+	"go-AVM/avm"
+	"go-AVM/avm/memory"
+	"go-AVM/avm/prefix"
+	"testing"
+)
+
+func TestLoadGasSchedules(t *testing.T) {
+	assert := assert.New(t)
+	set, err := avm.LoadGasSchedules("testdata/gas.json")
+	require.NoError(t, err)
+
+	s, err := set.At(0)
+	assert.NoError(err)
+	assert.Equal(uint64(40), s.Instructions[0x01])
+	assert.Equal(uint64(3), s.Instructions[0x12])
+	assert.Equal(uint64(2), s.Instructions[0x13])
+	assert.Equal(uint64(100), s.ChunkLoad)
+
+	s, err = set.At(1199)
+	assert.NoError(err)
+	assert.Equal(uint64(3), s.Instructions[0x12])
+
+	s, err = set.At(1200)
+	assert.NoError(err)
+	assert.Equal(uint64(5), s.Instructions[0x12], "changed costs should be applied")
+	assert.Equal(uint64(40), s.Instructions[0x01], "other costs should be inherited")
+	assert.Equal(uint64(150), s.ChunkLoad)
+	assert.Equal(uint64(1), s.ChunkByte)
+
+	s, err = set.At(1 << 40)
+	assert.NoError(err)
+	assert.Equal(uint64(4), s.Instructions[0x13], "the new default should be applied")
+	assert.Equal(uint64(5), s.Instructions[0x12], "explicit costs should not be overwritten by the default")
+	assert.Equal(uint64(150), s.ChunkLoad)
+
+	s, err = set.At(5000)
+	assert.NoError(err)
+	assert.Equal(uint64(40), s.Instructions[0x01])
+}
+
+func TestParseGasSchedules_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", `{"schedules": []}`},
+		{"syntax", `{"schedules": [`},
+		{"incomplete", `{"schedules": [{"activation": 0, "defaultInstructionCost": 1}]}`},
+		{"no activation", `{"schedules": [{"defaultInstructionCost": 1, "memoryByte": 1, "chunkLoad": 1, "chunkByte": 1}]}`},
+		{"zero cost", `{"schedules": [{"activation": 0, "defaultInstructionCost": 1, "instructions": {"0x10": 0},
+			"memoryByte": 1, "chunkLoad": 1, "chunkByte": 1}]}`},
+		{"invalid opcode", `{"schedules": [{"activation": 0, "defaultInstructionCost": 1, "instructions": {"0x100": 1},
+			"memoryByte": 1, "chunkLoad": 1, "chunkByte": 1}]}`},
+		{"activation order", `{"schedules": [{"activation": 5, "defaultInstructionCost": 1, "memoryByte": 1,
+			"chunkLoad": 1, "chunkByte": 1}, {"activation": 5}]}`},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := avm.ParseGasSchedules([]byte(testCase.data))
+			assert.Error(t, err)
+		})
+	}
+
+	set, err := avm.ParseGasSchedules([]byte(`{"schedules": [{"activation": 10, "defaultInstructionCost": 1,
+		"memoryByte": 1, "chunkLoad": 1, "chunkByte": 1}]}`))
+	require.NoError(t, err)
+	_, err = set.At(9)
+	assert.Equal(t, avm.ErrNoGasSchedule, err)
+}
+
+func TestController_SetGasSchedule(t *testing.T) {
+	set, err := avm.LoadGasSchedules("testdata/gas.json")
+	require.NoError(t, err)
+	methodArea := memory.NewMocker(map[prefix.Identifier64]map[prefix.Identifier64][]byte{
+		0x11: {
+			0: assembler.MustAssembleString("pushC64 2 pushC64 3 iAdd ret64"),
+		},
+	})
+
+	for version, want := range map[uint64]uint64{0: 2 + 2 + 3 + 2, 1200: 2 + 2 + 5 + 2, 5000: 4 + 4 + 5 + 4} {
+		s, err := set.At(version)
+		require.NoError(t, err)
+		controller := avm.NewController().SetGasSchedule(s)
+		controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+		_, gotError := controller.Emulate()
+		assert.Equal(t, avm.NoError, gotError)
+		assert.Equal(t, want, controller.GasUsed(), "version %d", version)
+	}
+
+	// changing the schedule must not affect the running session
+	s0, err := set.At(0)
+	require.NoError(t, err)
+	s5000, err := set.At(5000)
+	require.NoError(t, err)
+	controller := avm.NewController().SetGasSchedule(s0)
+	controller.SetupNewSession(0x11, nil, methodArea, memory.NewMocker(nil), defaultGasLimit)
+	assert.False(t, controller.EmulateNextInstruction())
+	controller.SetGasSchedule(s5000)
+	_, gotError := controller.Emulate()
+	assert.Equal(t, avm.NoError, gotError)
+	assert.Equal(t, uint64(2+2+3+2), controller.GasUsed())
+}
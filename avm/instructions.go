@@ -19,10 +19,18 @@ package avm
 
 import (
 	"go-AVM/avm/binary"
+	"go-AVM/avm/memory"
+	"math"
+	"math/bits"
 )
 
 func (p *Processor) noOp() {}
 
+// invalidOpcode is the routine of all opcodes that are not defined.
+func (p *Processor) invalidOpcode() {
+	panic(InvalidOpcode)
+}
+
 // invokeDispatcher invokes the dispatcher method of another application
 //
 // Format:
@@ -37,15 +45,15 @@ func (p *Processor) noOp() {}
 // is pushed onto the stack.
 func (p *Processor) invokeDispatcher() {
 	appID := p.popIdentifier64()
-	p.callMethod(appID, appID, DispatcherID)
+	// the chunk must be paid for before the callee is pushed
+	p.gas.consumeChunk(p.fetchChunk(p.methodArea, appID, DispatcherID))
+	p.callMethod(appID, appID, DispatcherID, false)
 }
 
 func (p *Processor) indInvokeDispatcher() {
-	p.invokeDispatcher()
-
-	// This should be done AFTER calling p.invokeDispatcher not before
-	p.current.isIndependent = true
-	p.heap.Save()
+	appID := p.popIdentifier64()
+	p.gas.consumeChunk(p.fetchChunk(p.methodArea, appID, DispatcherID))
+	p.callMethod(appID, appID, DispatcherID, true)
 }
 
 func (p *Processor) spawnDispatcher() {
@@ -57,20 +65,27 @@ func (p *Processor) spawnDispatcher() {
 	}
 
 	appID := p.popIdentifier64()
-	p.callStackQueue = append(p.callStackQueue, []*CallInfo{p.newCallInfo(appID, appID, DispatcherID)})
-	p.nextLocalFrame = newLocalFrame()
+	size := p.fetchChunk(p.methodArea, appID, DispatcherID)
+	p.gas.consumeChunk(size)
+	if size == 0 {
+		panic(InvalidReference)
+	}
+	callInfo := p.newCallInfo(appID, appID, DispatcherID)
+	callInfo.isIndependent = true
+	p.callStackQueue = append(p.callStackQueue, []*CallInfo{callInfo})
+	p.nextLocalFrame = newLocalFrame(p.gas)
 }
 
 func (p *Processor) invokeInternal() {
-	p.callMethod(p.current.context, p.current.methodID.appID, p.popIdentifier64())
+	method := p.popIdentifier64()
+	p.gas.consumeChunk(p.fetchChunk(p.methodArea, p.current.methodID.appID, method))
+	p.callMethod(p.current.context, p.current.methodID.appID, method, false)
 }
 
 func (p *Processor) indInvokeInternal() {
-	p.invokeInternal()
-
-	// This should be done AFTER calling p.invokeInternal not before
-	p.current.isIndependent = true
-	p.heap.Save()
+	method := p.popIdentifier64()
+	p.gas.consumeChunk(p.fetchChunk(p.methodArea, p.current.methodID.appID, method))
+	p.callMethod(p.current.context, p.current.methodID.appID, method, true)
 }
 
 func (p *Processor) ret0() {
@@ -83,8 +98,14 @@ func (p *Processor) ret64() {
 
 func (p *Processor) throw() {
 	top := p.current.operandStack.length()
-	n := binary.ReadUint16(p.current.operandStack.content, top-2)
-	p.throwBytes(int64(n)+2, SoftwareError)
+	if top < 2 {
+		panic(StackUnderflow)
+	}
+	n := int64(binary.ReadUint16(p.current.operandStack.content, top-2)) + 2
+	if n > top {
+		panic(StackUnderflow)
+	}
+	p.throwBytes(n, SoftwareError)
 }
 
 func (p *Processor) enter() {
@@ -97,15 +118,282 @@ func (p *Processor) enter() {
 	p.entranceLocks[p.current.context] = p.current.entranceLock
 }
 
+// errCode pushes the error code of the last call
+//
+// Format:
+//		errCode
+// OperandStack:
+// 		[... ->
+// 		[..., code <-
+// Description:
+//
+// The ErrorCode of the last call made by the current method is pushed onto
+// the operand stack as a 64-bit integer. When the call was successful `code`
+// is zero. Only independent calls can return an error to their caller, so
+// this instruction is normally used after indInvokeDispatcher or
+// indInvokeInternal.
+func (p *Processor) errCode() {
+	p.pushInt64(int64(p.errorStatus))
+}
+
+// errData pushes the data thrown by the last call
+//
+// Format:
+//		errData
+// OperandStack:
+// 		[... ->
+// 		[..., data, n <-
+// Description:
+//
+// The bytes thrown by the last call are pushed onto the operand stack with
+// the same layout that throw uses: `data` is followed by its length `n`,
+// which is an unsigned 16-bit integer. If the last call was successful, or
+// its error was raised by the AVM, `data` is empty and only `n = 0` is
+// pushed.
+func (p *Processor) errData() {
+	top := p.current.operandStack.length()
+	if len(p.errorData) == 0 {
+		p.current.operandStack.ensureLen(top + 2)
+		p.current.operandStack.content[top] = 0
+		p.current.operandStack.content[top+1] = 0
+		return
+	}
+	n := int64(len(p.errorData))
+	p.current.operandStack.ensureLen(top + n)
+	copy(p.current.operandStack.content[top:], p.errorData)
+}
+
+// lfStoreErrData stores the data thrown by the last call in the local frame
+//
+// Format:
+//		lfStoreErrData
+// OperandStack:
+// 		[..., index ->
+// 		[..., n <-
+// Description:
+//
+// `index` is popped from the operand stack and the data thrown by the last
+// call, without its length, is stored at the position `index` of the local
+// frame. The length of the data is pushed onto the operand stack as a 64-bit
+// integer. The local frame grows if needed. A negative `index` results in
+// LocalFrameOutOfRange.
+func (p *Processor) lfStoreErrData() {
+	index := p.popInt64()
+	if index < 0 || index > MaxLocalFrameSize {
+		panic(LocalFrameOutOfRange)
+	}
+	var data []byte
+	if l := len(p.errorData); l > 0 {
+		data = p.errorData[:l-2]
+	}
+	n := int64(len(data))
+	p.current.localFrame.ensureLen(index + n)
+	copy(p.current.localFrame.content[index:], data)
+	p.pushInt64(n)
+}
+
+// emitC16 emits an event
+//
+// Format:
+//		emitC16 2bN
+// OperandStack:
+// 		[..., data ->
+// 		[... <-
+// Description:
+//
+// `N` is an unsigned 16-bit integer. `N` bytes are popped from the operand
+// stack and are emitted as the data of an event of the current application.
+// If the heap changes of the call are reverted because of an error, the
+// event is reverted too.
+func (p *Processor) emitC16() {
+	n := int64(p.readConst16())
+	top := p.current.operandStack.length()
+	if top < n {
+		panic(StackUnderflow)
+	}
+	data := make([]byte, n)
+	copy(data, p.current.operandStack.content[top-n:top])
+	p.events = append(p.events, Event{App: p.current.context, Data: data})
+	p.current.operandStack.shrinkTo(top - n)
+}
+
 func (p *Processor) pushC64() {
+	p.checkConst(8)
 	top := p.current.operandStack.length()
 	p.current.operandStack.ensureLen(top + 8)
 	p.methodArea.Load64(p.current.pc, p.current.operandStack.content, top)
 	p.current.pc += 8
 }
 
+// pushC8 pushes a narrow constant onto the operand stack
+//
+// Format:
+//		pushC8 1bValue
+// OperandStack:
+// 		[... ->
+// 		[..., value <-
+// Description:
+//
+// The signed 8-bit constant `Value` is sign-extended to 64 bits and is
+// pushed onto the operand stack. pushC16 and pushC32 read 16-bit and 32-bit
+// constants, and pushUC8, pushUC16 and pushUC32 zero-extend their constants
+// instead of sign-extending them.
+func (p *Processor) pushC8() {
+	p.pushInt64(int64(int8(p.readConst8())))
+}
+
+func (p *Processor) pushC16() {
+	p.pushInt64(int64(int16(p.readConst16())))
+}
+
+func (p *Processor) pushC32() {
+	p.pushInt64(int64(int32(p.readConst32())))
+}
+
+func (p *Processor) pushUC8() {
+	p.pushInt64(int64(p.readConst8()))
+}
+
+func (p *Processor) pushUC16() {
+	p.pushInt64(int64(p.readConst16()))
+}
+
+func (p *Processor) pushUC32() {
+	p.pushInt64(int64(p.readConst32()))
+}
+
 func (p *Processor) pop() {
-	p.current.operandStack.shrinkTo(p.current.operandStack.length() - 8)
+	top := p.checkStackSlots(1)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// Stack manipulation instructions work on 64-bit slots. They fail with
+// StackUnderflow when the operand stack does not have enough slots.
+
+// dup duplicates the value on top of the stack.
+// 		[..., a ->
+// 		[..., a, a <-
+func (p *Processor) dup() {
+	top := p.checkStackSlots(1)
+	p.current.operandStack.ensureLen(top + 8)
+	binary.Copy64(p.current.operandStack.content, top, p.current.operandStack.content, top-8)
+}
+
+// dupC8 duplicates the N topmost slots of the stack
+//
+// Format:
+//		dupC8 1bN
+// OperandStack:
+// 		[..., x1, ..., xN ->
+// 		[..., x1, ..., xN, x1, ..., xN <-
+// Description:
+//
+// N is an unsigned 8-bit integer. For example, `dupC8 1d4` duplicates a
+// 256-bit integer.
+func (p *Processor) dupC8() {
+	n := int64(p.readConst8()) * 8
+	top := p.checkStackSlots(n / 8)
+	p.current.operandStack.ensureLen(top + n)
+	copy(p.current.operandStack.content[top:], p.current.operandStack.content[top-n:top])
+}
+
+// swap swaps the two topmost values of the stack.
+// 		[..., b, a ->
+// 		[..., a, b <-
+func (p *Processor) swap() {
+	top := p.checkStackSlots(2)
+	p.swapSlots(top-16, top-8)
+}
+
+// swapC8 swaps two blocks of N slots
+//
+// Format:
+//		swapC8 1bN
+// OperandStack:
+// 		[..., x1, ..., xN, y1, ..., yN ->
+// 		[..., y1, ..., yN, x1, ..., xN <-
+// Description:
+//
+// N is an unsigned 8-bit integer. The N topmost slots of the stack are
+// swapped with the N slots beneath them.
+func (p *Processor) swapC8() {
+	n := int64(p.readConst8()) * 8
+	top := p.checkStackSlots(n / 4)
+	for i := top - n; i < top; i += 8 {
+		p.swapSlots(i-n, i)
+	}
+}
+
+// over pushes a copy of the second value of the stack.
+// 		[..., b, a ->
+// 		[..., b, a, b <-
+func (p *Processor) over() {
+	top := p.checkStackSlots(2)
+	p.current.operandStack.ensureLen(top + 8)
+	binary.Copy64(p.current.operandStack.content, top, p.current.operandStack.content, top-16)
+}
+
+// rot moves the third value of the stack to the top.
+// 		[..., c, b, a ->
+// 		[..., b, a, c <-
+func (p *Processor) rot() {
+	top := p.checkStackSlots(3)
+	p.rollSlots(top, 2)
+}
+
+// dropC8 removes the N topmost slots of the stack
+//
+// Format:
+//		dropC8 1bN
+// OperandStack:
+// 		[..., x1, ..., xN ->
+// 		[... <-
+// Description:
+//
+// N is an unsigned 8-bit integer.
+func (p *Processor) dropC8() {
+	n := int64(p.readConst8())
+	top := p.checkStackSlots(n)
+	p.current.operandStack.shrinkTo(top - n*8)
+}
+
+// pickC16 pushes a copy of a value from the stack
+//
+// Format:
+//		pickC16 2bDepth
+// OperandStack:
+// 		[..., xDepth, ..., x1, x0 ->
+// 		[..., xDepth, ..., x1, x0, xDepth <-
+// Description:
+//
+// `Depth` is an unsigned 16-bit integer. The slot at the depth `Depth` is
+// copied to the top of the stack, where the depth of the topmost slot is
+// zero. `pickC16 2d0` is equivalent to dup and `pickC16 2d1` is equivalent
+// to over.
+func (p *Processor) pickC16() {
+	depth := int64(p.readConst16())
+	top := p.checkStackSlots(depth + 1)
+	p.current.operandStack.ensureLen(top + 8)
+	binary.Copy64(p.current.operandStack.content, top, p.current.operandStack.content, top-8*(depth+1))
+}
+
+// rollC16 moves a value of the stack to the top
+//
+// Format:
+//		rollC16 2bDepth
+// OperandStack:
+// 		[..., xDepth, ..., x1, x0 ->
+// 		[..., ..., x1, x0, xDepth <-
+// Description:
+//
+// `Depth` is an unsigned 16-bit integer. The slot at the depth `Depth` is
+// removed and is pushed onto the stack, where the depth of the topmost slot
+// is zero. `rollC16 2d1` is equivalent to swap and `rollC16 2d2` is
+// equivalent to rot.
+func (p *Processor) rollC16() {
+	depth := int64(p.readConst16())
+	top := p.checkStackSlots(depth + 1)
+	p.rollSlots(top, depth)
 }
 
 func (p *Processor) iAdd() {
@@ -120,72 +408,1473 @@ func (p *Processor) iSub() {
 	p.current.operandStack.shrinkTo(top - 8)
 }
 
-func (p *Processor) argC16() {
-	offset := int64(p.readConst16())
-	top := p.current.operandStack.length()
-	binary.Copy64(p.nextLocalFrame.content, offset, p.current.operandStack.content, top-8)
+func (p *Processor) iMul() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, b*a)
 	p.current.operandStack.shrinkTo(top - 8)
 }
 
-// lfLoadC16 loads 64 bits from the local frame using a 16-bit unsigned
-// constant index
+// iDiv divides two signed 64-bit integers
 //
 // Format:
-//		lfLoadC16 2bIndex
+//		iDiv
 // OperandStack:
-// 		[... ->
-// 		[..., value <-
+// 		[..., b, a ->
+// 		[..., b/a <-
 // Description:
 //
-// The `Index` is an unsigned 16-bit integer that must be an index into the
-// current local frame. Eight bytes from the position `Index` to `Index+7`
-// (inclusive) of the local frame is considered as a single `value` and is
-// pushed onto the operand stack.
-func (p *Processor) lfLoadC16() {
-	index := int64(p.readConst16())
-	top := p.current.operandStack.length()
-	p.current.operandStack.ensureLen(top + 8)
-	binary.Copy64(p.current.operandStack.content, top, p.current.localFrame.content, index)
+// The quotient is truncated toward zero. If `a` is zero the instruction
+// fails with DivisionByZero, and if the quotient is not representable, i.e.
+// `b` is the most negative value and `a` is -1, it fails with OverFlow.
+// iRem calculates the remainder of the same division, which has the sign of
+// `b`. uDiv and uRem perform the same operations on unsigned integers.
+func (p *Processor) iDiv() {
+	a, b, top := p.peekInt64()
+	if a == 0 {
+		panic(DivisionByZero)
+	}
+	if a == -1 && b == math.MinInt64 {
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, b/a)
+	p.current.operandStack.shrinkTo(top - 8)
 }
 
-func (p *Processor) lfStoreC16() {
-	index := int64(p.readConst16())
-	top := p.current.operandStack.length()
-	p.current.localFrame.ensureLen(index + 8)
-	binary.Copy64(p.current.localFrame.content, index, p.current.operandStack.content, top-8)
+func (p *Processor) iRem() {
+	a, b, top := p.peekInt64()
+	if a == 0 {
+		panic(DivisionByZero)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, b%a)
 	p.current.operandStack.shrinkTo(top - 8)
 }
 
-func (p *Processor) jmpEqC16() {
-	a, b, _ := p.peekInt64()
-	if a == b {
-		offset := int64(int16(p.readConst16()))
-		p.current.pc += offset
-	} else {
-		p.current.pc += 2
+// iNeg negates the signed integer on top of the stack. The most negative
+// value is left unchanged.
+func (p *Processor) iNeg() {
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, -a)
+}
+
+// iAbs replaces the signed integer on top of the stack with its absolute
+// value. The most negative value is left unchanged.
+func (p *Processor) iAbs() {
+	a, top := p.peekTopInt64()
+	if a < 0 {
+		binary.PutInt64(p.current.operandStack.content, top-8, -a)
 	}
 }
 
-/*
-// we will only have 64bit offset smaller integers will be used for push
+func (p *Processor) iMin() {
+	a, b, top := p.peekInt64()
+	if a < b {
+		binary.PutInt64(p.current.operandStack.content, top-16, a)
+	}
+	p.current.operandStack.shrinkTo(top - 8)
+}
 
-func (p *Processor) hLoadLocal() {
-	p.heap.LoadChild(0).LoadChild(readIdentifier64(p.operandStack.content, p.operandStack.top-8))
-	p.operandStack.top -= 8
+func (p *Processor) iMax() {
+	a, b, top := p.peekInt64()
+	if a > b {
+		binary.PutInt64(p.current.operandStack.content, top-16, a)
+	}
+	p.current.operandStack.shrinkTo(top - 8)
 }
 
-func (p *Processor) hUnLoadLocal() {
-	p.heap.UnLoadChild().UnLoadChild()
-	// check errors
+func (p *Processor) uDiv() {
+	a, b, top := p.peekUint64()
+	if a == 0 {
+		panic(DivisionByZero)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(b/a))
+	p.current.operandStack.shrinkTo(top - 8)
 }
 
-func (p *Processor) hLoad64() {
-	offset := readInt64(p.operandStack.content, p.operandStack.top-8)
-	err := p.heap.LoadBytes8(
-		offset,
-		p.operandStack.content[p.operandStack.top-8:])
-	if err != nil {
-		panic("ijkhjknt")
+func (p *Processor) uRem() {
+	a, b, top := p.peekUint64()
+	if a == 0 {
+		panic(DivisionByZero)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(b%a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uMin() {
+	a, b, top := p.peekUint64()
+	if a < b {
+		binary.PutInt64(p.current.operandStack.content, top-16, int64(a))
+	}
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uMax() {
+	a, b, top := p.peekUint64()
+	if a > b {
+		binary.PutInt64(p.current.operandStack.content, top-16, int64(a))
+	}
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// iAddChk adds two signed 64-bit integers with overflow detection
+//
+// Format:
+//		iAddChk
+// OperandStack:
+// 		[..., b, a ->
+// 		[..., b+a <-
+// Description:
+//
+// If the result is greater than the maximum value of a signed 64-bit
+// integer, the instruction fails with OverFlow and if it is less than the
+// minimum value, the instruction fails with UnderFlow. All the other checked
+// instructions (iSubChk, iMulChk, iNegChk, iAbsChk, uAddChk, uSubChk and
+// uMulChk) follow the same rules, while their unchecked counterparts
+// silently wrap around.
+func (p *Processor) iAddChk() {
+	a, b, top := p.peekInt64()
+	r := b + a
+	if a > 0 && r < b {
+		panic(OverFlow)
+	}
+	if a < 0 && r > b {
+		panic(UnderFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, r)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iSubChk() {
+	a, b, top := p.peekInt64()
+	r := b - a
+	if a < 0 && r < b {
+		panic(OverFlow)
+	}
+	if a > 0 && r > b {
+		panic(UnderFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, r)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iMulChk() {
+	a, b, top := p.peekInt64()
+	r := b * a
+	if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64)) {
+		if (a < 0) == (b < 0) {
+			panic(OverFlow)
+		}
+		panic(UnderFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, r)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iNegChk() {
+	a, top := p.peekTopInt64()
+	if a == math.MinInt64 {
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-8, -a)
+}
+
+func (p *Processor) iAbsChk() {
+	a, top := p.peekTopInt64()
+	if a == math.MinInt64 {
+		panic(OverFlow)
+	}
+	if a < 0 {
+		binary.PutInt64(p.current.operandStack.content, top-8, -a)
+	}
+}
+
+func (p *Processor) uAddChk() {
+	a, b, top := p.peekUint64()
+	r, carry := bits.Add64(b, a, 0)
+	if carry != 0 {
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(r))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uSubChk() {
+	a, b, top := p.peekUint64()
+	r, borrow := bits.Sub64(b, a, 0)
+	if borrow != 0 {
+		panic(UnderFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(r))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uMulChk() {
+	a, b, top := p.peekUint64()
+	hi, r := bits.Mul64(b, a)
+	if hi != 0 {
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(r))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) and() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, b&a)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) or() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, b|a)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) xor() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, b^a)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) not() {
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, ^a)
+}
+
+// shl shifts a 64-bit value to the left
+//
+// Format:
+//		shl
+// OperandStack:
+// 		[..., value, n ->
+// 		[..., value<<n <-
+// Description:
+//
+// `n` is an unsigned 64-bit integer. When `n` is greater than 63 the result
+// is zero. shr (logical shift right) and sar (arithmetic shift right) follow
+// the same rules, except that sar fills the result with the sign bit of
+// `value` when `n` is greater than 63. For rotl and rotr only the 6 least
+// significant bits of `n` are used.
+func (p *Processor) shl() {
+	n, v, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(v<<n))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) shr() {
+	n, v, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(v>>n))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) sar() {
+	n, v, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(v)>>n)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) rotl() {
+	n, v, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(bits.RotateLeft64(v, int(n&63))))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) rotr() {
+	n, v, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, int64(bits.RotateLeft64(v, -int(n&63))))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// popCnt replaces the value on top of the stack with the number of its one
+// bits. clz and ctz replace it with the number of its leading and trailing
+// zero bits. For zero, clz and ctz return 64.
+func (p *Processor) popCnt() {
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, int64(bits.OnesCount64(uint64(a))))
+}
+
+func (p *Processor) clz() {
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, int64(bits.LeadingZeros64(uint64(a))))
+}
+
+func (p *Processor) ctz() {
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, int64(bits.TrailingZeros64(uint64(a))))
+}
+
+// eq compares two 64-bit values for equality
+//
+// Format:
+//		eq
+// OperandStack:
+// 		[..., b, a ->
+// 		[..., b==a <-
+// Description:
+//
+// Both values are popped from the stack and 1 is pushed onto the stack if
+// `b` is equal to `a`, otherwise 0 is pushed. The other comparison
+// instructions compare `b` with `a` in the same way: ne (b != a),
+// iLt (b < a), iLe (b <= a), iGt (b > a) and iGe (b >= a) for signed
+// integers, and uLt, uLe, uGt and uGe for unsigned integers.
+func (p *Processor) eq() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b == a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) ne() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b != a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iLt() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b < a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iLe() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b <= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iGt() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b > a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) iGe() {
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b >= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uLt() {
+	a, b, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b < a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uLe() {
+	a, b, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b <= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uGt() {
+	a, b, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b > a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) uGe() {
+	a, b, top := p.peekUint64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b >= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// Floating point instructions operate on IEEE 754 double precision numbers.
+// Operands must be finite, otherwise InvalidOperands is raised. The rules
+// for raising PrecisionLoss, OverFlow and UnderFlow are described in fpu.go.
+//
+// Binary instructions use the same stack layout as integer instructions:
+// 		[..., b, a ->
+// 		[..., b op a <-
+
+// fAdd adds the two floats on top of the stack. Raises PrecisionLoss if
+// more than MaxAdditionLoss of the smaller operand is discarded.
+func (p *Processor) fAdd() {
+	a, b, top := p.peekFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-16, fpAdd(b, a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fSub subtracts `a` from `b`. The precision loss rule of fAdd applies.
+func (p *Processor) fSub() {
+	a, b, top := p.peekFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-16, fpSub(b, a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fMul multiplies the two floats on top of the stack.
+func (p *Processor) fMul() {
+	a, b, top := p.peekFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-16, fpMul(b, a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fDiv divides `b` by `a`. Raises DivisionByZero if `a` is zero.
+func (p *Processor) fDiv() {
+	a, b, top := p.peekFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-16, fpDiv(b, a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fSqrt replaces the float on top of the stack with its square root. The
+// operand must not be negative.
+func (p *Processor) fSqrt() {
+	a, top := p.peekTopFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-8, fpSqrt(a))
+}
+
+// fNeg negates the float on top of the stack.
+func (p *Processor) fNeg() {
+	a, top := p.peekTopFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-8, -a)
+}
+
+// fAbs replaces the float on top of the stack with its absolute value.
+func (p *Processor) fAbs() {
+	a, top := p.peekTopFloat64()
+	binary.PutFloat64(p.current.operandStack.content, top-8, math.Abs(a))
+}
+
+// fEq pushes 1 if `b` is equal to `a`, otherwise 0. Zero and negative zero
+// are equal.
+func (p *Processor) fEq() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b == a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fNe pushes 1 if `b` is not equal to `a`, otherwise 0.
+func (p *Processor) fNe() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b != a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fLt pushes 1 if `b` is less than `a`, otherwise 0.
+func (p *Processor) fLt() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b < a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fLe pushes 1 if `b` is less than or equal to `a`, otherwise 0.
+func (p *Processor) fLe() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b <= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fGt pushes 1 if `b` is greater than `a`, otherwise 0.
+func (p *Processor) fGt() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b > a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// fGe pushes 1 if `b` is greater than or equal to `a`, otherwise 0.
+func (p *Processor) fGe() {
+	a, b, top := p.peekFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-16, boolToInt64(b >= a))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// iToF converts the signed integer on top of the stack to a float. Raises
+// PrecisionLoss if the integer can not be represented exactly.
+func (p *Processor) iToF() {
+	a, top := p.peekTopInt64()
+	binary.PutFloat64(p.current.operandStack.content, top-8, intToFloat(a))
+}
+
+// fToI converts the float on top of the stack to a signed integer by
+// truncating its fractional part. Raises OverFlow or UnderFlow if the
+// result does not fit in 64 bits.
+func (p *Processor) fToI() {
+	a, top := p.peekTopFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-8, floatToInt(a))
+}
+
+// fTruncC8 drops the low order fractional bits of a float
+//
+// Format:
+//		fTruncC8 1bN
+// OperandStack:
+// 		[..., value ->
+// 		[..., truncated <-
+// Description:
+//
+// All the fractional bits of `value` except the first N ones are set to zero,
+// that is, `value` is rounded toward zero to a multiple of 2^-N. N is an
+// unsigned 8-bit integer.
+func (p *Processor) fTruncC8() {
+	n := int(p.readConst8())
+	a, top := p.peekTopFloat64()
+	binary.PutInt64(p.current.operandStack.content, top-8, int64(truncate(math.Float64bits(a), n)))
+}
+
+// dAddC8 adds two decimals
+//
+// Format:
+//		dAddC8 1bScaleB 1bScaleA
+// OperandStack:
+// 		[..., b, a ->
+// 		[..., b + a <-
+// Description:
+//
+// `b` is a decimal with the scale `ScaleB` and `a` is a decimal with the
+// scale `ScaleA`. The scale of the result is the greater one of the two
+// scales. The operand with the smaller scale is rescaled before the
+// addition, so the result is always exact. The rules for representing
+// decimals are described in decimal.go.
+func (p *Processor) dAddC8() {
+	sb, sa := p.readConst8(), p.readConst8()
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, decimalAdd(b, sb, a, sa))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// dSubC8 subtracts `a` from `b`. Its format and scale rules are the same as
+// dAddC8.
+func (p *Processor) dSubC8() {
+	sb, sa := p.readConst8(), p.readConst8()
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, decimalSub(b, sb, a, sa))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// dMulC8 multiplies two decimals
+//
+// Format:
+//		dMulC8 1bScale 1bRound
+// OperandStack:
+// 		[..., b, a ->
+// 		[..., b * a <-
+// Description:
+//
+// `a`, `b` and the result are decimals with the scale `Scale`. The exact
+// product is computed with 128 bits of precision and then is rounded
+// according to the RoundingMode `Round`.
+func (p *Processor) dMulC8() {
+	scale, mode := p.readConst8(), RoundingMode(p.readConst8())
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, decimalMul(b, a, scale, mode))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// dDivC8 divides `b` by `a`. Its format and rounding rules are the same as
+// dMulC8. Raises DivisionByZero if `a` is zero.
+func (p *Processor) dDivC8() {
+	scale, mode := p.readConst8(), RoundingMode(p.readConst8())
+	a, b, top := p.peekInt64()
+	binary.PutInt64(p.current.operandStack.content, top-16, decimalDiv(b, a, scale, mode))
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// dRescaleC8 changes the scale of a decimal
+//
+// Format:
+//		dRescaleC8 1bFrom 1bTo 1bRound
+// OperandStack:
+// 		[..., value ->
+// 		[..., rescaled <-
+// Description:
+//
+// `value` is a decimal with the scale `From`, and it is converted to a
+// decimal with the scale `To`. When `To` is less than `From` the result is
+// rounded according to the RoundingMode `Round`.
+func (p *Processor) dRescaleC8() {
+	from, to, mode := p.readConst8(), p.readConst8(), RoundingMode(p.readConst8())
+	a, top := p.peekTopInt64()
+	binary.PutInt64(p.current.operandStack.content, top-8, decimalRescale(a, from, to, mode))
+}
+
+// 256-bit integer instructions operate on 32-byte operands. Binary
+// instructions use the same stack layout as 64-bit integer instructions:
+// 		[..., b, a ->
+// 		[..., b op a <-
+// where `a` and `b` are 256-bit integers. Addition, subtraction and
+// multiplication wrap around modulo 2^256 and are the same for signed and
+// unsigned integers. Comparison instructions push a 64-bit boolean.
+
+// u256Add adds two 256-bit integers.
+func (p *Processor) u256Add() {
+	a, b, top := p.peekUint256()
+	r, _ := b.add(a)
+	p.putUint256Result(r, top)
+}
+
+// u256Sub subtracts `a` from `b`.
+func (p *Processor) u256Sub() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(b.sub(a), top)
+}
+
+// u256Mul multiplies two 256-bit integers.
+func (p *Processor) u256Mul() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(b.mul(a), top)
+}
+
+// u256Div divides `b` by `a` as unsigned integers. Raises DivisionByZero if `a`
+// is zero.
+func (p *Processor) u256Div() {
+	a, b, top := p.peekUint256()
+	if a.isZero() {
+		panic(DivisionByZero)
+	}
+	q, _ := b.divRem(a)
+	p.putUint256Result(q, top)
+}
+
+// u256Mod computes `b` mod `a` as unsigned integers.
+func (p *Processor) u256Mod() {
+	a, b, top := p.peekUint256()
+	if a.isZero() {
+		panic(DivisionByZero)
+	}
+	_, r := b.divRem(a)
+	p.putUint256Result(r, top)
+}
+
+// i256Div divides `b` by `a` as signed integers. The result is truncated toward
+// zero. Like iDiv, dividing the most negative value by -1 raises OverFlow.
+func (p *Processor) i256Div() {
+	a, b, top := p.peekUint256()
+	if a.isZero() {
+		panic(DivisionByZero)
+	}
+	if a == (uint256{}).not() && b == (uint256{3: 1 << 63}) {
+		panic(OverFlow)
+	}
+	q, _ := b.signedDivRem(a)
+	p.putUint256Result(q, top)
+}
+
+// i256Mod computes the remainder of the signed division of `b` by `a`. The
+// result has the sign of `b`.
+func (p *Processor) i256Mod() {
+	a, b, top := p.peekUint256()
+	if a.isZero() {
+		panic(DivisionByZero)
+	}
+	_, r := b.signedDivRem(a)
+	p.putUint256Result(r, top)
+}
+
+// u256AddMod computes a modular addition
+//
+// Format:
+//		u256AddMod
+// OperandStack:
+// 		[..., x, y, m ->
+// 		[..., (x + y) mod m <-
+// Description:
+//
+// `x`, `y` and `m` are unsigned 256-bit integers. The addition is done with
+// 257 bits of precision, so the result is not affected by wrapping around.
+// Raises DivisionByZero if `m` is zero.
+func (p *Processor) u256AddMod() {
+	p.checkStackSlots(12)
+	m, y, top := p.peekUint256()
+	x := uint256(binary.ReadUint256(p.current.operandStack.content, top-96))
+	if m.isZero() {
+		panic(DivisionByZero)
+	}
+	binary.PutUint256(p.current.operandStack.content, top-96, x.addMod(y, m))
+	p.current.operandStack.shrinkTo(top - 64)
+}
+
+// u256MulMod computes (x * y) mod m. The multiplication is done with 512
+// bits of precision. Its format and stack layout are the same as u256AddMod.
+func (p *Processor) u256MulMod() {
+	p.checkStackSlots(12)
+	m, y, top := p.peekUint256()
+	x := uint256(binary.ReadUint256(p.current.operandStack.content, top-96))
+	if m.isZero() {
+		panic(DivisionByZero)
+	}
+	binary.PutUint256(p.current.operandStack.content, top-96, x.mulMod(y, m))
+	p.current.operandStack.shrinkTo(top - 64)
+}
+
+// u256Exp computes `b` to the power of `a` modulo 2^256.
+func (p *Processor) u256Exp() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(b.exp(a), top)
+}
+
+// u256Eq pushes 1 if `b` is equal to `a`, otherwise 0.
+func (p *Processor) u256Eq() {
+	a, b, top := p.peekUint256()
+	p.putUint256Bool(b == a, top)
+}
+
+// u256Lt pushes 1 if `b` is less than `a` as unsigned integers, otherwise 0.
+func (p *Processor) u256Lt() {
+	a, b, top := p.peekUint256()
+	p.putUint256Bool(b.cmp(a) < 0, top)
+}
+
+// u256Gt pushes 1 if `b` is greater than `a` as unsigned integers, otherwise 0.
+func (p *Processor) u256Gt() {
+	a, b, top := p.peekUint256()
+	p.putUint256Bool(b.cmp(a) > 0, top)
+}
+
+// i256Lt pushes 1 if `b` is less than `a` as signed integers, otherwise 0.
+func (p *Processor) i256Lt() {
+	a, b, top := p.peekUint256()
+	p.putUint256Bool(b.signedCmp(a) < 0, top)
+}
+
+// i256Gt pushes 1 if `b` is greater than `a` as signed integers, otherwise 0.
+func (p *Processor) i256Gt() {
+	a, b, top := p.peekUint256()
+	p.putUint256Bool(b.signedCmp(a) > 0, top)
+}
+
+// u256IsZero replaces the 256-bit integer on top of the stack with a 64-bit
+// boolean which is 1 if the integer is zero.
+func (p *Processor) u256IsZero() {
+	a, top := p.peekTopUint256()
+	binary.PutInt64(p.current.operandStack.content, top-32, boolToInt64(a.isZero()))
+	p.current.operandStack.shrinkTo(top - 24)
+}
+
+// u256And computes the bitwise AND of two 256-bit integers.
+func (p *Processor) u256And() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(uint256{b[0] & a[0], b[1] & a[1], b[2] & a[2], b[3] & a[3]}, top)
+}
+
+// u256Or computes the bitwise OR of two 256-bit integers.
+func (p *Processor) u256Or() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(uint256{b[0] | a[0], b[1] | a[1], b[2] | a[2], b[3] | a[3]}, top)
+}
+
+// u256Xor computes the bitwise XOR of two 256-bit integers.
+func (p *Processor) u256Xor() {
+	a, b, top := p.peekUint256()
+	p.putUint256Result(uint256{b[0] ^ a[0], b[1] ^ a[1], b[2] ^ a[2], b[3] ^ a[3]}, top)
+}
+
+// u256Not computes the bitwise NOT of the 256-bit integer on top of the stack.
+func (p *Processor) u256Not() {
+	a, top := p.peekTopUint256()
+	binary.PutUint256(p.current.operandStack.content, top-32, a.not())
+}
+
+// i256Neg negates the 256-bit integer on top of the stack. The most
+// negative value is left unchanged.
+func (p *Processor) i256Neg() {
+	a, top := p.peekTopUint256()
+	binary.PutUint256(p.current.operandStack.content, top-32, a.neg())
+}
+
+// u256Shl shifts a 256-bit integer to the left
+//
+// Format:
+//		u256Shl
+// OperandStack:
+// 		[..., value, n ->
+// 		[..., value << n <-
+// Description:
+//
+// `value` is a 256-bit integer and `n` is an unsigned 64-bit integer. If `n`
+// is greater than 255 the result is zero. u256Shr and i256Sar use the same
+// stack layout. For i256Sar the result is -1 for negative values when `n`
+// is greater than 255.
+func (p *Processor) u256Shl() {
+	n := uint64(p.popInt64())
+	a, top := p.peekTopUint256()
+	binary.PutUint256(p.current.operandStack.content, top-32, a.shl(n))
+}
+
+func (p *Processor) u256Shr() {
+	n := uint64(p.popInt64())
+	a, top := p.peekTopUint256()
+	binary.PutUint256(p.current.operandStack.content, top-32, a.shr(n))
+}
+
+func (p *Processor) i256Sar() {
+	n := uint64(p.popInt64())
+	a, top := p.peekTopUint256()
+	binary.PutUint256(p.current.operandStack.content, top-32, a.sar(n))
+}
+
+// u256FromU64 zero-extends the 64-bit integer on top of the stack to 256
+// bits.
+func (p *Processor) u256FromU64() {
+	a, top := p.peekTopInt64()
+	p.current.operandStack.ensureLen(top + 24)
+	binary.PutUint256(p.current.operandStack.content, top-8, uint256{uint64(a)})
+}
+
+// i256FromI64 sign-extends the 64-bit integer on top of the stack to 256
+// bits.
+func (p *Processor) i256FromI64() {
+	a, top := p.peekTopInt64()
+	p.current.operandStack.ensureLen(top + 24)
+	ext := uint64(a >> 63)
+	binary.PutUint256(p.current.operandStack.content, top-8, uint256{uint64(a), ext, ext, ext})
+}
+
+// u256ToU64 converts the unsigned 256-bit integer on top of the stack to a
+// 64-bit integer. Raises OverFlow if the value does not fit in 64 bits.
+func (p *Processor) u256ToU64() {
+	a, top := p.peekTopUint256()
+	if a[1]|a[2]|a[3] != 0 {
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-32, int64(a[0]))
+	p.current.operandStack.shrinkTo(top - 24)
+}
+
+// i256ToI64 converts the signed 256-bit integer on top of the stack to a
+// signed 64-bit integer. Raises OverFlow or UnderFlow if the value does not
+// fit in 64 bits.
+func (p *Processor) i256ToI64() {
+	a, top := p.peekTopUint256()
+	ext := uint64(int64(a[0]) >> 63)
+	if a[1] != ext || a[2] != ext || a[3] != ext {
+		if a.isNegative() {
+			panic(UnderFlow)
+		}
+		panic(OverFlow)
+	}
+	binary.PutInt64(p.current.operandStack.content, top-32, int64(a[0]))
+	p.current.operandStack.shrinkTo(top - 24)
+}
+
+func (p *Processor) argC16() {
+	offset := int64(p.readConst16())
+	top := p.checkStackSlots(1)
+	p.nextLocalFrame.ensureLen(offset + 8)
+	binary.Copy64(p.nextLocalFrame.content, offset, p.current.operandStack.content, top-8)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// lfLoadC16 loads 64 bits from the local frame using a 16-bit unsigned
+// constant index
+//
+// Format:
+//		lfLoadC16 2bIndex
+// OperandStack:
+// 		[... ->
+// 		[..., value <-
+// Description:
+//
+// The `Index` is an unsigned 16-bit integer that must be an index into the
+// current local frame. Eight bytes from the position `Index` to `Index+7`
+// (inclusive) of the local frame is considered as a single `value` and is
+// pushed onto the operand stack.
+func (p *Processor) lfLoadC16() {
+	index := int64(p.readConst16())
+	if index+8 > p.current.localFrame.length() {
+		panic(LocalFrameOutOfRange)
+	}
+	top := p.current.operandStack.length()
+	p.current.operandStack.ensureLen(top + 8)
+	binary.Copy64(p.current.operandStack.content, top, p.current.localFrame.content, index)
+}
+
+func (p *Processor) lfStoreC16() {
+	index := int64(p.readConst16())
+	top := p.checkStackSlots(1)
+	p.current.localFrame.ensureLen(index + 8)
+	binary.Copy64(p.current.localFrame.content, index, p.current.operandStack.content, top-8)
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// lfLoadC8 is the compact form of lfLoadC16 for the first 256 bytes of the
+// local frame. Its `Index` is an unsigned 8-bit integer.
+func (p *Processor) lfLoadC8() {
+	p.lfLoadN(int64(p.readConst8()), 8)
+}
+
+// lfStoreC8 is the compact form of lfStoreC16 for the first 256 bytes of the
+// local frame. Its `Index` is an unsigned 8-bit integer.
+func (p *Processor) lfStoreC8() {
+	p.lfStoreN(int64(p.readConst8()), 8)
+}
+
+// lfLoad8C16 loads 8 bits from the local frame using a 16-bit unsigned
+// constant index
+//
+// Format:
+//		lfLoad8C16 2bIndex
+// OperandStack:
+// 		[... ->
+// 		[..., value <-
+// Description:
+//
+// The byte at the position `Index` of the local frame is zero-extended to 64
+// bits and is pushed onto the operand stack. lfLoad16C16 and lfLoad32C16
+// load 2 and 4 bytes from `Index` to `Index+1` and `Index+3` (inclusive).
+func (p *Processor) lfLoad8C16() {
+	p.lfLoadN(int64(p.readConst16()), 1)
+}
+
+func (p *Processor) lfLoad16C16() {
+	p.lfLoadN(int64(p.readConst16()), 2)
+}
+
+func (p *Processor) lfLoad32C16() {
+	p.lfLoadN(int64(p.readConst16()), 4)
+}
+
+// lfStore8C16 stores 8 bits in the local frame using a 16-bit unsigned
+// constant index
+//
+// Format:
+//		lfStore8C16 2bIndex
+// OperandStack:
+// 		[..., value ->
+// 		[... <-
+// Description:
+//
+// `value` is popped from the operand stack and its least significant byte is
+// stored at the position `Index` of the local frame. lfStore16C16 and
+// lfStore32C16 store the 2 and 4 least significant bytes of `value`.
+func (p *Processor) lfStore8C16() {
+	p.lfStoreN(int64(p.readConst16()), 1)
+}
+
+func (p *Processor) lfStore16C16() {
+	p.lfStoreN(int64(p.readConst16()), 2)
+}
+
+func (p *Processor) lfStore32C16() {
+	p.lfStoreN(int64(p.readConst16()), 4)
+}
+
+// lfLoad loads 64 bits from the local frame using an index from the operand
+// stack
+//
+// Format:
+//		lfLoad
+// OperandStack:
+// 		[..., index ->
+// 		[..., value <-
+// Description:
+//
+// `index` is popped from the operand stack and eight bytes from the position
+// `index` to `index+7` (inclusive) of the local frame is pushed onto the
+// operand stack. If the range is not inside the local frame the instruction
+// fails with LocalFrameOutOfRange. lfLoad8, lfLoad16 and lfLoad32 load 1, 2 and
+// 4 bytes and zero-extend them to 64 bits.
+func (p *Processor) lfLoad() {
+	p.lfLoadN(p.popInt64(), 8)
+}
+
+func (p *Processor) lfLoad8() {
+	p.lfLoadN(p.popInt64(), 1)
+}
+
+func (p *Processor) lfLoad16() {
+	p.lfLoadN(p.popInt64(), 2)
+}
+
+func (p *Processor) lfLoad32() {
+	p.lfLoadN(p.popInt64(), 4)
+}
+
+// lfStore stores 64 bits in the local frame using an index from the operand
+// stack
+//
+// Format:
+//		lfStore
+// OperandStack:
+// 		[..., value, index ->
+// 		[... <-
+// Description:
+//
+// `index` and `value` are popped from the operand stack and `value` is
+// stored at the position `index` of the local frame. The local frame grows
+// if needed. A negative `index` results in LocalFrameOutOfRange. lfStore8,
+// lfStore16 and lfStore32 store the 1, 2 and 4 least significant bytes of
+// `value`.
+func (p *Processor) lfStore() {
+	p.lfStoreN(p.popInt64(), 8)
+}
+
+func (p *Processor) lfStore8() {
+	p.lfStoreN(p.popInt64(), 1)
+}
+
+func (p *Processor) lfStore16() {
+	p.lfStoreN(p.popInt64(), 2)
+}
+
+func (p *Processor) lfStore32() {
+	p.lfStoreN(p.popInt64(), 4)
+}
+
+// jmpC16 unconditionally jumps using a 16-bit signed offset
+//
+// Format:
+//		jmpC16 2bOffset
+// OperandStack:
+// 		[... ->
+// 		[... <-
+// Description:
+//
+// The 16-bit signed `Offset` is added to the pc. The `Offset` is relative to
+// the end of the instruction.
+func (p *Processor) jmpC16() {
+	p.jumpC16(true)
+}
+
+// jmpEqC16 jumps if the two topmost values are equal
+//
+// Format:
+//		jmpEqC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is equal to `a`, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpEqC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(b == a)
+}
+
+// jmpNeC16 jumps if the two topmost values are not equal
+//
+// Format:
+//		jmpNeC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is not equal to `a`, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpNeC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(b != a)
+}
+
+// jmpLtC16 jumps if a signed value is less than another
+//
+// Format:
+//		jmpLtC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is less than `a` as signed integers, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpLtC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(b < a)
+}
+
+// jmpGeC16 jumps if a signed value is greater than or equal to another
+//
+// Format:
+//		jmpGeC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is greater than or equal to `a` as signed integers, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpGeC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(b >= a)
+}
+
+// jmpULtC16 jumps if an unsigned value is less than another
+//
+// Format:
+//		jmpULtC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is less than `a` as unsigned integers, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpULtC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(uint64(b) < uint64(a))
+}
+
+// jmpUGeC16 jumps if an unsigned value is greater than or equal to another
+//
+// Format:
+//		jmpUGeC16 2bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is greater than or equal to `a` as unsigned integers, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpUGeC16() {
+	a, b := p.popTwoInt64()
+	p.jumpC16(uint64(b) >= uint64(a))
+}
+
+// jmpZC16 jumps if the topmost value is zero
+//
+// Format:
+//		jmpZC16 2bOffset
+// OperandStack:
+// 		[..., value ->
+// 		[... <-
+// Description:
+//
+// `value` is popped from the operand stack. If `value` is zero, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpZC16() {
+	p.jumpC16(p.popInt64() == 0)
+}
+
+// jmpNzC16 jumps if the topmost value is not zero
+//
+// Format:
+//		jmpNzC16 2bOffset
+// OperandStack:
+// 		[..., value ->
+// 		[... <-
+// Description:
+//
+// `value` is popped from the operand stack. If `value` is not zero, the 16-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpNzC16() {
+	p.jumpC16(p.popInt64() != 0)
+}
+
+// jmpC32 unconditionally jumps using a 32-bit signed offset
+//
+// Format:
+//		jmpC32 4bOffset
+// OperandStack:
+// 		[... ->
+// 		[... <-
+// Description:
+//
+// The 32-bit signed `Offset` is added to the pc. The `Offset` is relative to
+// the end of the instruction.
+func (p *Processor) jmpC32() {
+	p.jumpC32(true)
+}
+
+// jmpEqC32 jumps if the two topmost values are equal
+//
+// Format:
+//		jmpEqC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is equal to `a`, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpEqC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(b == a)
+}
+
+// jmpNeC32 jumps if the two topmost values are not equal
+//
+// Format:
+//		jmpNeC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is not equal to `a`, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpNeC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(b != a)
+}
+
+// jmpLtC32 jumps if a signed value is less than another
+//
+// Format:
+//		jmpLtC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is less than `a` as signed integers, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpLtC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(b < a)
+}
+
+// jmpGeC32 jumps if a signed value is greater than or equal to another
+//
+// Format:
+//		jmpGeC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is greater than or equal to `a` as signed integers, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpGeC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(b >= a)
+}
+
+// jmpULtC32 jumps if an unsigned value is less than another
+//
+// Format:
+//		jmpULtC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is less than `a` as unsigned integers, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpULtC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(uint64(b) < uint64(a))
+}
+
+// jmpUGeC32 jumps if an unsigned value is greater than or equal to another
+//
+// Format:
+//		jmpUGeC32 4bOffset
+// OperandStack:
+// 		[..., b, a ->
+// 		[... <-
+// Description:
+//
+// `a` and `b` are popped from the operand stack. If `b` is greater than or equal to `a` as unsigned integers, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpUGeC32() {
+	a, b := p.popTwoInt64()
+	p.jumpC32(uint64(b) >= uint64(a))
+}
+
+// jmpZC32 jumps if the topmost value is zero
+//
+// Format:
+//		jmpZC32 4bOffset
+// OperandStack:
+// 		[..., value ->
+// 		[... <-
+// Description:
+//
+// `value` is popped from the operand stack. If `value` is zero, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpZC32() {
+	p.jumpC32(p.popInt64() == 0)
+}
+
+// jmpNzC32 jumps if the topmost value is not zero
+//
+// Format:
+//		jmpNzC32 4bOffset
+// OperandStack:
+// 		[..., value ->
+// 		[... <-
+// Description:
+//
+// `value` is popped from the operand stack. If `value` is not zero, the 32-bit
+// signed `Offset` is added to the pc. The `Offset` is relative to the end of
+// the instruction.
+func (p *Processor) jmpNzC32() {
+	p.jumpC32(p.popInt64() != 0)
+}
+
+// jmpTable jumps to one of the targets of a jump table
+//
+// Format:
+//		jmpTable 2bN 4bDefault 4bOffset0 4bOffset1 ... 4bOffset(N-1)
+// OperandStack:
+// 		[..., index ->
+// 		[... <-
+// Description:
+//
+// `index` is popped from the operand stack and is treated as an unsigned
+// integer. If `index` is less than N, the 32-bit signed `Offset(index)` is
+// added to the pc, otherwise the 32-bit signed `Default` offset is used.
+// All offsets are relative to the end of the instruction, that is, the end
+// of the last offset of the table.
+func (p *Processor) jmpTable() {
+	n := int64(p.readConst16())
+	p.checkConst(4 + 4*n)
+	index := uint64(p.popInt64())
+	table := p.current.pc
+	end := table + 4 + 4*n
+	position := table
+	if index < uint64(n) {
+		position += 4 + 4*int64(index)
+	}
+	p.current.pc = end + int64(int32(p.methodArea.LoadUint32(position)))
+}
+
+// hLoadLocal selects a heap chunk of the current context
+//
+// Format:
+//		hLoadLocal
+// OperandStack:
+// 		[..., id64 ->
+// 		[... <-
+// Description:
+//
+// `id64` is the identifier of a chunk under the heap root of the current
+// context. This identifier is popped from the stack and the chunk becomes
+// the current chunk for all heap load and store instructions. A chunk that
+// does not exist is considered an empty chunk, and it will be created by the
+// first store. The selection is kept when other methods are called.
+func (p *Processor) hLoadLocal() {
+	id := p.popIdentifier64()
+	p.fetchChunk(p.heap, p.current.context, id)
+	p.heap.LoadChild(id)
+	p.touched[memory.ChunkID{Root: p.current.context, Child: id}] = true
+	p.gas.consumeChunk(p.heap.ChunkSize())
+	p.current.heapChunk = id
+	p.current.hasHeapChunk = true
+}
+
+// hUnLoadLocal unloads the current heap chunk. After this instruction heap
+// loads and stores fail with InvalidReference until another chunk is
+// selected.
+func (p *Processor) hUnLoadLocal() {
+	p.heap.UnLoadChild()
+	p.current.hasHeapChunk = false
+}
+
+func (p *Processor) hLoad8() {
+	offset := p.popHeapLoadOffset(1)
+	p.pushInt64(int64(p.heap.LoadByte(offset)))
+}
+
+func (p *Processor) hLoad16() {
+	offset := p.popHeapLoadOffset(2)
+	p.pushInt64(int64(p.heap.LoadUint16(offset)))
+}
+
+func (p *Processor) hLoad32() {
+	offset := p.popHeapLoadOffset(4)
+	p.pushInt64(int64(p.heap.LoadUint32(offset)))
+}
+
+// hLoad64 loads 64 bits from the current heap chunk
+//
+// Format:
+//		hLoad64
+// OperandStack:
+// 		[..., offset ->
+// 		[..., value <-
+// Description:
+//
+// The `offset` is a 64-bit integer that is popped from the stack. Eight
+// bytes from the position `offset` to `offset+7` (inclusive) of the current
+// heap chunk is considered as a single `value` and is pushed onto the
+// operand stack. The narrower versions of this instruction, hLoad8, hLoad16
+// and hLoad32, zero-extend the loaded value to 64 bits.
+func (p *Processor) hLoad64() {
+	offset := p.popHeapLoadOffset(8)
+	p.pushInt64(p.heap.LoadInt64(offset))
+}
+
+func (p *Processor) hStore8() {
+	p.hStoreN(1)
+}
+
+func (p *Processor) hStore16() {
+	p.hStoreN(2)
+}
+
+func (p *Processor) hStore32() {
+	p.hStoreN(4)
+}
+
+// hStore64 stores 64 bits in the current heap chunk
+//
+// Format:
+//		hStore64
+// OperandStack:
+// 		[..., value, offset ->
+// 		[... <-
+// Description:
+//
+// The `offset` and the 64-bit `value` are popped from the stack and `value`
+// is stored in the current heap chunk from the position `offset` to
+// `offset+7` (inclusive). Storing past the end of a chunk makes the chunk
+// grow. The narrower versions of this instruction, hStore8, hStore16 and
+// hStore32, only store the least significant bytes of `value`.
+func (p *Processor) hStore64() {
+	offset := p.popHeapStoreOffset(8)
+	top := p.checkStackSlots(1)
+	p.heap.StoreBytes8(offset, p.current.operandStack.content[top-8:top])
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func (p *Processor) hStoreN(n int) {
+	offset := p.popHeapStoreOffset(int64(n))
+	top := p.checkStackSlots(1)
+	p.heap.StoreBytes(offset, n, p.current.operandStack.content[top-8:top])
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+// hLoadBytesC16 loads a range of bytes from the current heap chunk
+//
+// Format:
+//		hLoadBytesC16 2bN
+// OperandStack:
+// 		[..., offset ->
+// 		[..., bytes <-
+// Description:
+//
+// `N` is an unsigned 16-bit integer. `N` bytes from the position `offset` of
+// the current heap chunk are pushed onto the operand stack as they are.
+func (p *Processor) hLoadBytesC16() {
+	n := int64(p.readConst16())
+	offset := p.popHeapLoadOffset(n)
+	top := p.current.operandStack.length()
+	p.current.operandStack.ensureLen(top + n)
+	p.heap.LoadBytes(offset, n, p.current.operandStack.content, top)
+}
+
+// hStoreBytesC16 stores a range of bytes in the current heap chunk
+//
+// Format:
+//		hStoreBytesC16 2bN
+// OperandStack:
+// 		[..., bytes, offset ->
+// 		[... <-
+// Description:
+//
+// `N` is an unsigned 16-bit integer. `N` bytes are popped from the operand
+// stack and stored in the current heap chunk from the position `offset`.
+func (p *Processor) hStoreBytesC16() {
+	n := int64(p.readConst16())
+	offset := p.popHeapStoreOffset(n)
+	top := p.current.operandStack.length()
+	if top < n {
+		panic(StackUnderflow)
 	}
+	p.heap.StoreBytes(offset, int(n), p.current.operandStack.content[top-n:top])
+	p.current.operandStack.shrinkTo(top - n)
 }
-*/
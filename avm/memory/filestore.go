@@ -0,0 +1,415 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	. "go-AVM/avm/prefix"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	batchMagic      = 0x314d5641 // "AVM1"
+	batchHeaderSize = 12
+	opPut           = 1
+	opDelete        = 2
+)
+
+var ErrStoreClosed = errors.New("memory: file store is closed")
+
+// ErrNotDurable is returned by Compact when the log has been replaced but
+// the replacement could not be persisted. The store is still usable, but
+// after a crash the old log may be found instead of the compacted one.
+var ErrNotDurable = errors.New("memory: compacted log may not be durable")
+
+// ErrCorruptedLog is returned by OpenFileStore when the log contains an
+// invalid batch that is followed by other data. Only the last batch of the
+// log can be partially written, so this is not caused by a crash.
+var ErrCorruptedLog = errors.New("memory: log file is corrupted")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// FileStore is a persistent ChunkStore. Chunks are stored in an append-only
+// log file and an in-memory index of the file is built when the store is
+// opened.
+//
+// Put and Delete only record the changes in memory. Commit appends all the
+// recorded changes to the log as a single batch and syncs the file. Every
+// batch has a header containing its length and checksum, so a batch that is
+// partially written because of a crash is detected and removed when the
+// store is opened again. This way the store always recovers to the last
+// committed state.
+//
+// Log format:
+//		batch:  magic(4) payloadLength(4) crc32c(4) payload
+//		put:    1 root(8) child(8) length(4) chunk
+//		delete: 2 root(8) child(8)
+// All integers are little-endian.
+type FileStore struct {
+	path    string
+	file    *os.File
+	size    int64
+	index   map[ChunkID]chunkLocation
+	pending map[ChunkID][]byte
+}
+
+type chunkLocation struct {
+	offset int64
+	length uint32
+}
+
+// OpenFileStore opens the store at `path`. The file is created if it does
+// not exist.
+func OpenFileStore(path string) (*FileStore, error) {
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if os.IsNotExist(statErr) {
+		if err = syncDir(path); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	s := &FileStore{
+		path:    path,
+		file:    f,
+		index:   map[ChunkID]chunkLocation{},
+		pending: map[ChunkID][]byte{},
+	}
+	if err = s.recover(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover rebuilds the index by replaying the log. An invalid batch at the
+// end of the log is a torn write and is truncated. An invalid batch that is
+// followed by other data is reported as ErrCorruptedLog, because truncating
+// it could discard committed batches.
+func (s *FileStore) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+	header := make([]byte, batchHeaderSize)
+	for s.size+batchHeaderSize <= fileSize {
+		if _, err = s.file.ReadAt(header, s.size); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(header) != batchMagic {
+			return ErrCorruptedLog
+		}
+		payloadLen := int64(binary.LittleEndian.Uint32(header[4:]))
+		end := s.size + batchHeaderSize + payloadLen
+		if end > fileSize {
+			break
+		}
+		payload := make([]byte, payloadLen)
+		if _, err = s.file.ReadAt(payload, s.size+batchHeaderSize); err != nil {
+			return err
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[8:]) ||
+			!s.indexBatch(payload, s.size+batchHeaderSize) {
+			if end < fileSize {
+				return ErrCorruptedLog
+			}
+			break
+		}
+		s.size = end
+	}
+	if s.size < fileSize {
+		if err = s.file.Truncate(s.size); err != nil {
+			return err
+		}
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// indexBatch adds the operations of a batch to the index. `base` is the
+// offset of the payload in the file. The index will not be modified if the
+// payload is malformed.
+func (s *FileStore) indexBatch(payload []byte, base int64) bool {
+	type operation struct {
+		id       ChunkID
+		location *chunkLocation
+	}
+	var ops []operation
+	for i := int64(0); i < int64(len(payload)); {
+		if i+17 > int64(len(payload)) {
+			return false
+		}
+		op := payload[i]
+		id := ChunkID{
+			Root:  Identifier64(binary.LittleEndian.Uint64(payload[i+1:])),
+			Child: Identifier64(binary.LittleEndian.Uint64(payload[i+9:])),
+		}
+		i += 17
+		switch op {
+		case opPut:
+			if i+4 > int64(len(payload)) {
+				return false
+			}
+			length := binary.LittleEndian.Uint32(payload[i:])
+			i += 4
+			if i+int64(length) > int64(len(payload)) {
+				return false
+			}
+			ops = append(ops, operation{id, &chunkLocation{base + i, length}})
+			i += int64(length)
+		case opDelete:
+			ops = append(ops, operation{id, nil})
+		default:
+			return false
+		}
+	}
+	for _, op := range ops {
+		if op.location == nil {
+			delete(s.index, op.id)
+		} else {
+			s.index[op.id] = *op.location
+		}
+	}
+	return true
+}
+
+func (s *FileStore) Get(root, child Identifier64) ([]byte, error) {
+	if s.file == nil {
+		return nil, ErrStoreClosed
+	}
+	id := ChunkID{root, child}
+	if chunk, exists := s.pending[id]; exists {
+		if chunk == nil {
+			return nil, ErrChunkNotFound
+		}
+		return chunk, nil
+	}
+	location, exists := s.index[id]
+	if !exists {
+		return nil, ErrChunkNotFound
+	}
+	return s.read(location)
+}
+
+// read reads a committed chunk from the log.
+func (s *FileStore) read(location chunkLocation) ([]byte, error) {
+	chunk := make([]byte, location.length)
+	if _, err := s.file.ReadAt(chunk, location.offset); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// Put records a chunk for the next commit.
+func (s *FileStore) Put(root, child Identifier64, chunk []byte) error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	if chunk == nil {
+		chunk = []byte{}
+	}
+	s.pending[ChunkID{root, child}] = chunk
+	return nil
+}
+
+// Delete records the deletion of a chunk for the next commit.
+func (s *FileStore) Delete(root, child Identifier64) error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	s.pending[ChunkID{root, child}] = nil
+	return nil
+}
+
+// Commit atomically writes all the changes recorded by Put and Delete to the
+// disk. When Commit returns an error, the file is left in its last committed
+// state and the changes remain pending.
+func (s *FileStore) Commit() error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	if len(s.pending) == 0 {
+		return nil
+	}
+	batch := encodeBatch(s.pending)
+	if _, err := s.file.WriteAt(batch, s.size); err != nil {
+		_ = s.file.Truncate(s.size)
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		_ = s.file.Truncate(s.size)
+		return err
+	}
+	s.indexBatch(batch[batchHeaderSize:], s.size+batchHeaderSize)
+	s.size += int64(len(batch))
+	s.pending = map[ChunkID][]byte{}
+	return nil
+}
+
+// Compact rewrites the log so that it only contains the latest version of
+// every chunk. The new log is written to a temporary file that atomically
+// replaces the current log. Pending changes are not affected.
+func (s *FileStore) Compact() error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	live := make(map[ChunkID][]byte, len(s.index))
+	for id, location := range s.index {
+		chunk, err := s.read(location)
+		if err != nil {
+			return err
+		}
+		live[id] = chunk
+	}
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var batch []byte
+	if len(live) > 0 {
+		batch = encodeBatch(live)
+	}
+	if _, err = tmp.Write(batch); err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	// the old log has been replaced, so from now on we must use the new one
+	_ = s.file.Close()
+	s.file = tmp
+	s.size = int64(len(batch))
+	s.index = map[ChunkID]chunkLocation{}
+	if len(batch) > 0 {
+		s.indexBatch(batch[batchHeaderSize:], batchHeaderSize)
+	}
+	if err = syncDir(s.path); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotDurable, err)
+	}
+	return nil
+}
+
+// ForEach calls `f` for every committed chunk in a deterministic order.
+// Pending changes are ignored.
+func (s *FileStore) ForEach(f func(id ChunkID, chunk []byte) error) error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	ids := make([]ChunkID, 0, len(s.index))
+	for id := range s.index {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	for _, id := range ids {
+		chunk, err := s.read(s.index[id])
+		if err != nil {
+			return err
+		}
+		if err = f(id, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the log file. Pending changes are discarded.
+func (s *FileStore) Close() error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.pending = nil
+	return err
+}
+
+func encodeBatch(changes map[ChunkID][]byte) []byte {
+	ids := make([]ChunkID, 0, len(changes))
+	size := batchHeaderSize
+	for id, chunk := range changes {
+		ids = append(ids, id)
+		size += 17
+		if chunk != nil {
+			size += 4 + len(chunk)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+
+	batch := make([]byte, batchHeaderSize, size)
+	for _, id := range ids {
+		chunk := changes[id]
+		op := byte(opPut)
+		if chunk == nil {
+			op = opDelete
+		}
+		batch = append(batch, op)
+		batch = appendUint64(batch, uint64(id.Root))
+		batch = appendUint64(batch, uint64(id.Child))
+		if chunk != nil {
+			batch = appendUint32(batch, uint32(len(chunk)))
+			batch = append(batch, chunk...)
+		}
+	}
+	payload := batch[batchHeaderSize:]
+	binary.LittleEndian.PutUint32(batch, batchMagic)
+	binary.LittleEndian.PutUint32(batch[4:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(batch[8:], crc32.Checksum(payload, crcTable))
+	return batch
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// syncDir makes sure that the directory entry of a newly created or renamed
+// file is persisted.
+// syncDir is a variable so tests can simulate failures.
+var syncDir = func(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore_CommitAndReopen(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+
+	assert.NoError(s.Put(0x11, 1, []byte{1, 2, 3}))
+	assert.NoError(s.Put(0x11, 2, []byte{4}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Delete(0x11, 2))
+	assert.NoError(s.Put(0x12, 1, []byte{}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Put(0x11, 1, []byte{9}))
+	assert.NoError(s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	chunk, err := s.Get(0x11, 1)
+	assert.NoError(err)
+	assert.Equal([]byte{1, 2, 3}, chunk, "uncommitted changes should not be persisted")
+	_, err = s.Get(0x11, 2)
+	assert.Equal(ErrChunkNotFound, err)
+	chunk, err = s.Get(0x12, 1)
+	assert.NoError(err)
+	assert.Equal([]byte{}, chunk)
+	assert.NoError(s.Close())
+}
+
+func TestFileStore_Recovery(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	assert.NoError(s.Put(0x11, 1, []byte{1, 2, 3}))
+	assert.NoError(s.Commit())
+	committedSize := s.size
+	assert.NoError(s.Close())
+
+	// simulating a crash in the middle of writing a batch
+	batch := encodeBatch(map[ChunkID][]byte{{0x11, 1}: {7, 7, 7, 7}, {0x11, 5}: {5}})
+	for _, torn := range [][]byte{batch[:5], batch[:len(batch)-1], append(batch[:len(batch)-1:len(batch)-1], 0)} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = f.Write(torn)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s, err = OpenFileStore(path)
+		require.NoError(t, err)
+		assert.Equal(committedSize, s.size)
+		chunk, err := s.Get(0x11, 1)
+		assert.NoError(err)
+		assert.Equal([]byte{1, 2, 3}, chunk)
+		_, err = s.Get(0x11, 5)
+		assert.Equal(ErrChunkNotFound, err)
+		assert.NoError(s.Close())
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(committedSize, info.Size(), "the torn batch should be truncated")
+	}
+}
+
+func TestFileStore_Corruption(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	assert.NoError(s.Put(0x11, 1, []byte{1, 2, 3}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Put(0x11, 2, []byte{4}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// corrupting the first batch, which is followed by a valid batch
+	for _, offset := range []int{0, batchHeaderSize + 1} {
+		corrupted := append([]byte(nil), data...)
+		corrupted[offset] ^= 0xff
+		require.NoError(t, os.WriteFile(path, corrupted, 0644))
+		_, err = OpenFileStore(path)
+		assert.Equal(ErrCorruptedLog, err)
+		stored, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(corrupted, stored, "a corrupted log should not be truncated")
+	}
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	for i := byte(0); i < 10; i++ {
+		assert.NoError(s.Put(0x11, 1, []byte{i, i}))
+		assert.NoError(s.Put(0x11, 2, []byte{i}))
+		assert.NoError(s.Commit())
+	}
+	assert.NoError(s.Delete(0x11, 2))
+	assert.NoError(s.Commit())
+	sizeBefore := s.size
+
+	assert.NoError(s.Compact())
+	assert.Less(s.size, sizeBefore)
+	assert.NoError(s.Put(0x11, 3, []byte{3}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	var ids []ChunkID
+	assert.NoError(s.ForEach(func(id ChunkID, chunk []byte) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	assert.Equal([]ChunkID{{0x11, 1}, {0x11, 3}}, ids)
+	chunk, err := s.Get(0x11, 1)
+	assert.NoError(err)
+	assert.Equal([]byte{9, 9}, chunk)
+	assert.NoError(s.Close())
+}
+
+func TestFileStore_ForEach(t *testing.T) {
+	assert := assert.New(t)
+	s, err := OpenFileStore(filepath.Join(t.TempDir(), "heap.log"))
+	require.NoError(t, err)
+	assert.NoError(s.Put(0x11, 1, []byte{1}))
+	assert.NoError(s.Put(0x11, 2, []byte{2}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Delete(0x11, 1))
+	assert.NoError(s.Put(0x11, 2, []byte{9}))
+	assert.NoError(s.Put(0x11, 3, []byte{3}))
+
+	chunks := map[ChunkID][]byte{}
+	assert.NoError(s.ForEach(func(id ChunkID, chunk []byte) error {
+		chunks[id] = chunk
+		return nil
+	}))
+	assert.Equal(map[ChunkID][]byte{{0x11, 1}: {1}, {0x11, 2}: {2}}, chunks, "pending changes should be ignored")
+	assert.NoError(s.Close())
+	assert.Equal(ErrStoreClosed, s.ForEach(func(ChunkID, []byte) error { return nil }))
+}
+
+func TestFileStore_CompactSyncDirFailure(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	assert.NoError(s.Put(0x11, 1, []byte{1}))
+	assert.NoError(s.Commit())
+
+	defer func(f func(string) error) { syncDir = f }(syncDir)
+	syncDir = func(string) error { return errors.New("sync failed") }
+	err = s.Compact()
+	assert.True(errors.Is(err, ErrNotDurable))
+	_, statErr := os.Stat(path + ".tmp")
+	assert.True(os.IsNotExist(statErr), "the compacted log must have replaced the old one")
+
+	// the store must keep using the new log, so later commits are not lost
+	assert.NoError(s.Put(0x11, 2, []byte{2}))
+	assert.NoError(s.Commit())
+	assert.NoError(s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	chunk, err := s.Get(0x11, 2)
+	assert.NoError(err)
+	assert.Equal([]byte{2}, chunk)
+	chunk, err = s.Get(0x11, 1)
+	assert.NoError(err)
+	assert.Equal([]byte{1}, chunk)
+	assert.NoError(s.Close())
+}
+
+func TestFileStore_Module(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "heap.log")
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+
+	m := New(s)
+	m.Save()
+	m.LoadRoot(0x11).LoadChild(1)
+	writeByte(m, 2, 7)
+	m.Save()
+	m.LoadChild(2)
+	writeByte(m, 0, 1)
+	m.Restore()
+	m.Discard()
+	assert.NoError(m.Commit())
+	assert.NoError(s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	m = New(s)
+	m.LoadRoot(0x11).LoadChild(1)
+	assert.Equal([]byte{0, 0, 7}, m.current)
+	m.LoadChild(2)
+	assert.Equal(int64(0), m.ChunkSize())
+	assert.NoError(s.Close())
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// TreeDepth is the depth of a SparseMerkleTree. Every leaf of the tree
+// corresponds to a ChunkID: the 64 bits of the root identifier followed by
+// the 64 bits of the child identifier, from the most significant bit, form
+// the path from the root of the tree to the leaf.
+const TreeDepth = 128
+
+const (
+	leafPrefix     = 0x00
+	internalPrefix = 0x01
+)
+
+type Hash [32]byte
+
+// defaultHashes[d] is the hash of an empty subtree whose root is at the
+// depth d.
+var defaultHashes [TreeDepth + 1]Hash
+
+func init() {
+	for d := TreeDepth - 1; d >= 0; d-- {
+		defaultHashes[d] = hashNode(defaultHashes[d+1], defaultHashes[d+1])
+	}
+}
+
+// SparseMerkleTree is an authenticated data structure over a set of chunks.
+// Its root hash is a deterministic commitment to the content of all chunks.
+// The hash of a non-existent chunk is all zeros, and only nodes with a
+// non-default hash are kept in memory.
+//
+// Hashing rules:
+//		leaf:     sha256(0x00 || root(8) || child(8) || sha256(chunk))
+//		internal: sha256(0x01 || left || right)
+// Identifiers are encoded in little-endian.
+type SparseMerkleTree struct {
+	nodes map[treeNode]Hash
+}
+
+type treeNode struct {
+	depth uint8
+	path  ChunkID
+}
+
+// Proof is a proof of inclusion or exclusion of a chunk. Siblings contains
+// the non-default sibling hashes from the leaf level to the root level. The
+// bit `i` of Bitmap is set when the sibling at the height `i` is non-default
+// and is included in Siblings.
+type Proof struct {
+	Bitmap   [TreeDepth / 8]byte
+	Siblings []Hash
+}
+
+func NewSparseMerkleTree() *SparseMerkleTree {
+	return &SparseMerkleTree{nodes: map[treeNode]Hash{}}
+}
+
+// Root returns the root hash of the tree.
+func (t *SparseMerkleTree) Root() Hash {
+	return t.get(0, ChunkID{})
+}
+
+// Update sets the content of a chunk. A nil chunk removes the chunk from the
+// tree.
+func (t *SparseMerkleTree) Update(id ChunkID, chunk []byte) {
+	h := hashLeaf(id, chunk)
+	for depth := TreeDepth; depth > 0; depth-- {
+		path := prefixOf(id, depth)
+		t.set(depth, path, h)
+		sibling := t.get(depth, flipBit(path, depth-1))
+		if bitAt(id, depth-1) == 0 {
+			h = hashNode(h, sibling)
+		} else {
+			h = hashNode(sibling, h)
+		}
+	}
+	t.set(0, ChunkID{}, h)
+}
+
+// Prove returns a proof for the current content of a chunk. If the chunk
+// does not exist, the proof is a proof of exclusion.
+func (t *SparseMerkleTree) Prove(id ChunkID) Proof {
+	var proof Proof
+	for depth := TreeDepth; depth > 0; depth-- {
+		height := TreeDepth - depth
+		sibling := t.get(depth, flipBit(prefixOf(id, depth), depth-1))
+		if sibling != defaultHashes[depth] {
+			proof.Bitmap[height/8] |= 1 << (height % 8)
+			proof.Siblings = append(proof.Siblings, sibling)
+		}
+	}
+	return proof
+}
+
+// VerifyProof checks a proof against a root hash. A nil chunk verifies a
+// proof of exclusion.
+func VerifyProof(root Hash, id ChunkID, chunk []byte, proof Proof) bool {
+	h := hashLeaf(id, chunk)
+	next := 0
+	for depth := TreeDepth; depth > 0; depth-- {
+		height := TreeDepth - depth
+		sibling := defaultHashes[depth]
+		if proof.Bitmap[height/8]&(1<<(height%8)) != 0 {
+			if next >= len(proof.Siblings) {
+				return false
+			}
+			sibling = proof.Siblings[next]
+			next++
+		}
+		if bitAt(id, depth-1) == 0 {
+			h = hashNode(h, sibling)
+		} else {
+			h = hashNode(sibling, h)
+		}
+	}
+	return next == len(proof.Siblings) && h == root
+}
+
+func (t *SparseMerkleTree) get(depth int, path ChunkID) Hash {
+	if h, exists := t.nodes[treeNode{uint8(depth), path}]; exists {
+		return h
+	}
+	return defaultHashes[depth]
+}
+
+func (t *SparseMerkleTree) set(depth int, path ChunkID, h Hash) {
+	if h == defaultHashes[depth] {
+		delete(t.nodes, treeNode{uint8(depth), path})
+	} else {
+		t.nodes[treeNode{uint8(depth), path}] = h
+	}
+}
+
+func hashLeaf(id ChunkID, chunk []byte) Hash {
+	if chunk == nil {
+		return defaultHashes[TreeDepth]
+	}
+	var b [1 + 16 + 32]byte
+	b[0] = leafPrefix
+	binary.LittleEndian.PutUint64(b[1:], uint64(id.Root))
+	binary.LittleEndian.PutUint64(b[9:], uint64(id.Child))
+	contentHash := sha256.Sum256(chunk)
+	copy(b[17:], contentHash[:])
+	return sha256.Sum256(b[:])
+}
+
+func hashNode(left, right Hash) Hash {
+	var b [1 + 64]byte
+	b[0] = internalPrefix
+	copy(b[1:], left[:])
+	copy(b[33:], right[:])
+	return sha256.Sum256(b[:])
+}
+
+// bitAt returns the bit `i` of the path of a chunk, where the bit 0 is the
+// most significant bit of the root identifier.
+func bitAt(id ChunkID, i int) uint64 {
+	if i < 64 {
+		return uint64(id.Root) >> (63 - i) & 1
+	}
+	return uint64(id.Child) >> (127 - i) & 1
+}
+
+func flipBit(id ChunkID, i int) ChunkID {
+	if i < 64 {
+		id.Root ^= 1 << (63 - i)
+	} else {
+		id.Child ^= 1 << (127 - i)
+	}
+	return id
+}
+
+// prefixOf returns the first `depth` bits of the path of a chunk. The rest of
+// the bits will be zero.
+func prefixOf(id ChunkID, depth int) ChunkID {
+	switch {
+	case depth == 0:
+		return ChunkID{}
+	case depth < 64:
+		id.Root &= ^(1<<(64-depth) - 1)
+		id.Child = 0
+	case depth == 64:
+		id.Child = 0
+	case depth < 128:
+		id.Child &= ^(1<<(128-depth) - 1)
+	}
+	return id
+}
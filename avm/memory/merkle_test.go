@@ -0,0 +1,121 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"github.com/stretchr/testify/assert"
+	. "go-AVM/avm/prefix"
+	"testing"
+)
+
+func TestSparseMerkleTree_Root(t *testing.T) {
+	assert := assert.New(t)
+	chunks := map[ChunkID][]byte{
+		{0x11, 1}:                  {1, 2, 3},
+		{0x11, 2}:                  {},
+		{0x11, 3}:                  {7},
+		{0x8000000000000000, 0x11}: {5},
+	}
+	order1 := []ChunkID{{0x11, 1}, {0x11, 2}, {0x11, 3}, {0x8000000000000000, 0x11}}
+	order2 := []ChunkID{{0x8000000000000000, 0x11}, {0x11, 3}, {0x11, 2}, {0x11, 1}}
+
+	t1 := NewSparseMerkleTree()
+	assert.Equal(defaultHashes[0], t1.Root())
+	for _, id := range order1 {
+		t1.Update(id, chunks[id])
+	}
+	t2 := NewSparseMerkleTree()
+	for _, id := range order2 {
+		t2.Update(id, chunks[id])
+	}
+	assert.Equal(t1.Root(), t2.Root(), "the root hash should not depend on the order of updates")
+
+	t2.Update(ChunkID{0x11, 2}, nil)
+	assert.NotEqual(t1.Root(), t2.Root(), "an empty chunk and a non-existent chunk are different")
+	t2.Update(ChunkID{0x11, 2}, []byte{})
+	assert.Equal(t1.Root(), t2.Root())
+
+	for _, id := range order1 {
+		t1.Update(id, nil)
+	}
+	assert.Equal(defaultHashes[0], t1.Root())
+	assert.Empty(t1.nodes)
+}
+
+func TestSparseMerkleTree_Proof(t *testing.T) {
+	assert := assert.New(t)
+	tree := NewSparseMerkleTree()
+	tree.Update(ChunkID{0x11, 2}, []byte{1, 2})
+	tree.Update(ChunkID{0x11, 3}, []byte{3})
+	tree.Update(ChunkID{0x12, 2}, []byte{4})
+	root := tree.Root()
+
+	proof := tree.Prove(ChunkID{0x11, 2})
+	assert.Len(proof.Siblings, 2)
+	assert.True(VerifyProof(root, ChunkID{0x11, 2}, []byte{1, 2}, proof))
+	assert.False(VerifyProof(root, ChunkID{0x11, 2}, []byte{1, 3}, proof))
+	assert.False(VerifyProof(root, ChunkID{0x11, 2}, nil, proof))
+	assert.False(VerifyProof(root, ChunkID{0x11, 3}, []byte{1, 2}, proof))
+
+	proof = tree.Prove(ChunkID{0x11, 6})
+	assert.True(VerifyProof(root, ChunkID{0x11, 6}, nil, proof), "exclusion proof")
+	assert.False(VerifyProof(root, ChunkID{0x11, 6}, []byte{}, proof))
+
+	proof = tree.Prove(ChunkID{0x12, 2})
+	proof.Siblings = proof.Siblings[1:]
+	assert.False(VerifyProof(root, ChunkID{0x12, 2}, []byte{4}, proof))
+}
+
+func TestModule_StateRoot(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMapStore(map[Identifier64]map[Identifier64][]byte{
+		0x11: {1: {1, 1}, 2: {2, 2}},
+	})
+	tree := NewSparseMerkleTree()
+	assert.NoError(store.ForEach(func(id ChunkID, chunk []byte) error {
+		tree.Update(id, chunk)
+		return nil
+	}))
+	m := New(store)
+	_, err := m.StateRoot()
+	assert.Equal(ErrNoStateTree, err)
+	m.SetStateTree(tree)
+	rootBefore, err := m.StateRoot()
+	assert.NoError(err)
+
+	m.Save()
+	m.LoadRoot(0x11).LoadChild(1)
+	writeByte(m, 0, 5)
+	m.LoadChild(2)
+	m.DeleteChunk()
+	m.LoadRoot(0x12).LoadChild(9)
+	writeByte(m, 0, 9)
+	m.Discard()
+	root, err := m.StateRoot()
+	assert.NoError(err)
+	assert.Equal(rootBefore, root, "the state root should only change on commit")
+
+	assert.NoError(m.Commit())
+	want := NewSparseMerkleTree()
+	want.Update(ChunkID{0x11, 1}, []byte{5, 1})
+	want.Update(ChunkID{0x12, 9}, []byte{9})
+	root, err = m.StateRoot()
+	assert.NoError(err)
+	assert.Equal(want.Root(), root)
+	assert.True(VerifyProof(root, ChunkID{0x11, 2}, nil, tree.Prove(ChunkID{0x11, 2})))
+}
@@ -18,17 +18,65 @@
 package memory
 
 import (
+	"errors"
 	"fmt"
 	"go-AVM/avm/binary"
 	. "go-AVM/avm/prefix"
+	"sort"
 	"strings"
 )
 
+// MaxChunkSize is the maximum size of a chunk in bytes. A chunk can grow up
+// to this size by writing past its end.
+const MaxChunkSize = 64 * 1024
+
+var (
+	ErrChunkSizeExceeded = errors.New("memory: max chunk size exceeded")
+	ErrNoChunkLoaded     = errors.New("memory: no chunk is loaded")
+	ErrOpenCheckpoint    = errors.New("memory: can not commit while there are open checkpoints")
+	ErrNoCheckpoint      = errors.New("memory: there is no open checkpoint")
+	ErrNoStateTree       = errors.New("memory: no state tree is attached")
+	ErrPoisoned          = errors.New("memory: module contains changes that could not be reverted")
+)
+
+// ChunkID identifies a chunk by the root it belongs to and its identifier
+// under that root.
+type ChunkID struct {
+	Root  Identifier64
+	Child Identifier64
+}
+
 // Module error handling will be done by panicking instead of returning errors
+//
+// A Module keeps a stack of nested checkpoints. Every checkpoint is a
+// copy-on-write layer: the first time a chunk is modified after a call to
+// Save, a private copy of the chunk is made in the active checkpoint and all
+// writes go to that copy. Restore drops the active checkpoint with all of its
+// copies, and Discard merges them into the enclosing checkpoint. This makes
+// Save cheap enough to be called on every independent call.
+//
+// Chunks are read lazily from a ChunkStore when they are loaded for the
+// first time. When the outermost checkpoint is discarded its modifications
+// are kept in the module until Commit is called. In all layers a nil chunk
+// represents a deleted chunk.
 type Module struct {
-	chunks    map[Identifier64]map[Identifier64][]byte
-	root      map[Identifier64][]byte
-	current   []byte
+	store ChunkStore
+	// fetched contains all the chunks that have been read from the store.
+	fetched map[ChunkID][]byte
+	// changes contains the modifications that are not committed to the
+	// store yet.
+	changes     map[ChunkID][]byte
+	stateTree   *SparseMerkleTree
+	checkpoints []map[ChunkID][]byte
+	currentID   ChunkID
+	current     []byte
+	isLoaded    bool
+	// isWritable shows that current is owned by the active checkpoint and
+	// can be modified in place.
+	isWritable bool
+	// poisoned shows that the module contains changes that must never be
+	// committed.
+	poisoned  bool
 	accessLog strings.Builder
 }
 
@@ -37,25 +85,49 @@ func (m *Module) AccessLog() string {
 }
 
 // LoadRoot must not panic
+//
+// LoadRoot does not read anything from the store.
 func (m *Module) LoadRoot(id Identifier64) *Module {
 	// println("root changed:-> ", id)
-	m.root = m.chunks[id]
+	m.currentID = ChunkID{Root: id}
 	m.current = nil
+	m.isLoaded = false
+	m.isWritable = false
 	m.accessLog.WriteString(fmt.Sprintf("root<-%x   ", id))
 	return m
 }
 
-// LoadChild must not panic
+// LoadChild must not panic, unless the underlying store fails to read the
+// chunk. Use Fetch for reading the chunk without panicking. A chunk that does
+// not exist is loaded as an empty chunk.
 func (m *Module) LoadChild(id Identifier64) *Module {
 	// println("child changed:-> ", id)
-	m.current = m.root[id]
+	m.currentID.Child = id
+	m.current, m.isWritable = m.lookup(m.currentID)
+	m.isLoaded = true
 	m.accessLog.WriteString(fmt.Sprintf("child<-%x   ", id))
 	return nil
 }
 
+// UnLoadChild unloads the current chunk. After calling this function, the
+// module will be in the same state as after calling LoadRoot.
 func (m *Module) UnLoadChild() *Module {
+	m.currentID.Child = 0
+	m.current = nil
+	m.isLoaded = false
+	m.isWritable = false
 	m.accessLog.WriteString("UnLoad   ")
-	return nil
+	return m
+}
+
+// ChunkSize returns the size of the current chunk in bytes. When no chunk
+// is loaded, ChunkSize returns -1. A chunk that does not exist is considered
+// an empty chunk.
+func (m *Module) ChunkSize() int64 {
+	if !m.isLoaded {
+		return -1
+	}
+	return int64(len(m.current))
 }
 
 func (m *Module) Load64(loadIndex int64, dst []byte, writeIndex int64) {
@@ -69,7 +141,25 @@ func (m *Module) LoadUint16(index int64) uint16 {
 	return v
 }
 
+func (m *Module) LoadUint32(index int64) uint32 {
+	v := binary.ReadUint32(m.current, index)
+	m.accessLog.WriteString(fmt.Sprintf("[%d]->%x   ", index, v))
+	return v
+}
+
+// LoadBytes copies `num` bytes from the position `offset` of the current
+// chunk to the position `writeIndex` of `dst`.
+func (m *Module) LoadBytes(offset int64, num int64, dst []byte, writeIndex int64) {
+	m.accessLog.WriteString(fmt.Sprintf("[%d]->%x   ", offset, m.current[offset:offset+num]))
+	binary.CopyBytes(dst, writeIndex, m.current, offset, num)
+}
+
+// StoreBytes8 stores the first 8 bytes of `src` at the position `offset` of
+// the current chunk. Writing past the end of a chunk makes the chunk grow.
 func (m *Module) StoreBytes8(offset int64, src []byte) {
+	chunk := m.prepareWrite(offset + 8)
+	binary.Copy64(chunk, offset, src, 0)
+	m.accessLog.WriteString(fmt.Sprintf("[%d]<-%x   ", offset, chunk[offset:offset+8]))
 }
 
 func (m *Module) LoadByte(index int64) byte {
@@ -79,27 +169,251 @@ func (m *Module) LoadByte(index int64) byte {
 }
 
 func (m *Module) LoadInt64(offset int64) int64 {
-	return 0
+	v := binary.ReadInt64(m.current, offset)
+	m.accessLog.WriteString(fmt.Sprintf("[%d]->%x   ", offset, v))
+	return v
 }
 
+// StoreBytes stores the first `num` bytes of `src` at the position `offset`
+// of the current chunk. Writing past the end of a chunk makes the chunk grow.
 func (m *Module) StoreBytes(offset int64, num int, src []byte) {
+	chunk := m.prepareWrite(offset + int64(num))
+	copy(chunk[offset:offset+int64(num)], src[:num])
+	m.accessLog.WriteString(fmt.Sprintf("[%d]<-%x   ", offset, chunk[offset:offset+int64(num)]))
 }
 
+// Save creates a new checkpoint. All the modifications made after calling
+// Save can be reverted by calling Restore.
+func (m *Module) Save() {
+	m.checkpoints = append(m.checkpoints, map[ChunkID][]byte{})
+	m.isWritable = false
+	m.accessLog.WriteString("Save   ")
+}
+
+// Restore reverts all the modifications made since the last call to Save
+// and removes the last checkpoint.
 func (m *Module) Restore() {
+	top := len(m.checkpoints) - 1
+	if top < 0 {
+		panic(ErrNoCheckpoint)
+	}
+	m.checkpoints[top] = nil
+	m.checkpoints = m.checkpoints[:top]
+	m.reloadCurrent()
 	m.accessLog.WriteString("Restore   ")
 }
 
+// Discard removes the last checkpoint while keeping its modifications. The
+// modifications are merged into the enclosing checkpoint. When there is no
+// enclosing checkpoint, the modifications will be written to the store by
+// the next call to Commit.
 func (m *Module) Discard() {
+	top := len(m.checkpoints) - 1
+	if top < 0 {
+		panic(ErrNoCheckpoint)
+	}
+	parent := m.changes
+	if top > 0 {
+		parent = m.checkpoints[top-1]
+	}
+	for id, chunk := range m.checkpoints[top] {
+		parent[id] = chunk
+	}
+	m.checkpoints[top] = nil
+	m.checkpoints = m.checkpoints[:top]
+	m.reloadCurrent()
 	m.accessLog.WriteString("Discard   ")
 }
 
-func (m *Module) Save() {
-	m.accessLog.WriteString("Save   ")
+// Poison makes Commit fail with ErrPoisoned. It is used when the changes of
+// a failed session could not be reverted. A poisoned module can not be used
+// anymore, and the changes must be discarded by creating a new module.
+func (m *Module) Poison() {
+	m.poisoned = true
 }
 
-func NewMocker(chunks map[Identifier64]map[Identifier64][]byte) *Module {
+// lookup finds the latest version of a chunk. isWritable shows if the
+// returned chunk belongs to the active checkpoint.
+func (m *Module) lookup(id ChunkID) (chunk []byte, isWritable bool) {
+	top := len(m.checkpoints) - 1
+	for i := top; i >= 0; i-- {
+		if chunk, exists := m.checkpoints[i][id]; exists {
+			return chunk, i == top
+		}
+	}
+	if chunk, exists := m.changes[id]; exists {
+		return chunk, top < 0
+	}
+	return m.fetch(id), false
+}
+
+func (m *Module) fetch(id ChunkID) []byte {
+	if err := m.read(id); err != nil {
+		panic(err)
+	}
+	return m.fetched[id]
+}
+
+// read reads a chunk from the store if it has not been read before.
+func (m *Module) read(id ChunkID) error {
+	if _, exists := m.fetched[id]; exists {
+		return nil
+	}
+	chunk, err := m.store.Get(id.Root, id.Child)
+	if err == ErrChunkNotFound {
+		chunk = nil
+	} else if err != nil {
+		return err
+	}
+	m.fetched[id] = chunk
+	return nil
+}
+
+// Fetch makes sure that a chunk has been read from the store and returns
+// the size of its latest version. After a successful Fetch, loading the
+// chunk never reads the store, so LoadChild can not fail. Fetch does not
+// change the current chunk.
+func (m *Module) Fetch(root, child Identifier64) (int64, error) {
+	id := ChunkID{Root: root, Child: child}
+	if err := m.read(id); err != nil {
+		return 0, err
+	}
+	chunk, _ := m.lookup(id)
+	return int64(len(chunk)), nil
+}
+
+func (m *Module) reloadCurrent() {
+	if m.isLoaded {
+		m.current, m.isWritable = m.lookup(m.currentID)
+	}
+}
+
+// prepareWrite returns the current chunk after making sure that it is owned
+// by the active checkpoint and its length is at least `length`.
+func (m *Module) prepareWrite(length int64) []byte {
+	if m.isWritable && length <= int64(len(m.current)) {
+		return m.current
+	}
+	if !m.isLoaded {
+		panic(ErrNoChunkLoaded)
+	}
+	if length > MaxChunkSize {
+		panic(ErrChunkSizeExceeded)
+	}
+	chunk := make([]byte, max(length, int64(len(m.current))))
+	copy(chunk, m.current)
+	m.current = chunk
+	m.isWritable = true
+	m.activeLayer()[m.currentID] = chunk
+	return chunk
+}
+
+// DeleteChunk deletes the current chunk. Like any other modification,
+// deleting a chunk can be reverted by Restore. A deleted chunk is loaded as
+// an empty chunk.
+func (m *Module) DeleteChunk() {
+	if !m.isLoaded {
+		panic(ErrNoChunkLoaded)
+	}
+	m.current = nil
+	m.isWritable = false
+	m.activeLayer()[m.currentID] = nil
+	m.accessLog.WriteString("Delete   ")
+}
+
+func (m *Module) activeLayer() map[ChunkID][]byte {
+	if top := len(m.checkpoints) - 1; top >= 0 {
+		return m.checkpoints[top]
+	}
+	return m.changes
+}
+
+// Commit writes all the modifications that are not inside an open
+// checkpoint to the store. Chunks are written in a deterministic order. If a
+// state tree is attached to the module, it is updated after the store has
+// accepted the changes.
+func (m *Module) Commit() error {
+	if m.poisoned {
+		return ErrPoisoned
+	}
+	if len(m.checkpoints) != 0 {
+		return ErrOpenCheckpoint
+	}
+	ids := make([]ChunkID, 0, len(m.changes))
+	for id := range m.changes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	for _, id := range ids {
+		var err error
+		chunk := m.changes[id]
+		if chunk == nil {
+			err = m.store.Delete(id.Root, id.Child)
+		} else {
+			err = m.store.Put(id.Root, id.Child, chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if committer, ok := m.store.(Committer); ok {
+		if err := committer.Commit(); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		chunk := m.changes[id]
+		if m.stateTree != nil {
+			m.stateTree.Update(id, chunk)
+		}
+		m.fetched[id] = chunk
+		delete(m.changes, id)
+	}
+	// committed chunks are shared with the store and must not be modified
+	m.reloadCurrent()
+	return nil
+}
+
+// SetStateTree attaches a state tree to the module. The tree must contain
+// all the chunks of the store, and after that, it will be updated by
+// Commit.
+func (m *Module) SetStateTree(t *SparseMerkleTree) {
+	m.stateTree = t
+}
+
+// StateRoot returns the root hash of the attached state tree. If no state
+// tree is attached, it returns ErrNoStateTree.
+func (m *Module) StateRoot() (Hash, error) {
+	if m.stateTree == nil {
+		return Hash{}, ErrNoStateTree
+	}
+	return m.stateTree.Root(), nil
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (id ChunkID) less(other ChunkID) bool {
+	if id.Root != other.Root {
+		return id.Root < other.Root
+	}
+	return id.Child < other.Child
+}
+
+// New creates a Module that reads and writes its chunks from `store`.
+func New(store ChunkStore) *Module {
 	return &Module{
-		chunks:    chunks,
+		store:     store,
+		fetched:   map[ChunkID][]byte{},
+		changes:   map[ChunkID][]byte{},
 		accessLog: strings.Builder{},
 	}
 }
+
+func NewMocker(chunks map[Identifier64]map[Identifier64][]byte) *Module {
+	return New(NewMapStore(chunks))
+}
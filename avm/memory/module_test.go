@@ -0,0 +1,201 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	. "go-AVM/avm/prefix"
+	"testing"
+)
+
+func writeByte(m *Module, index int64, v byte) {
+	m.prepareWrite(index + 1)[index] = v
+}
+
+func TestModule_SaveRestoreDiscard(t *testing.T) {
+	assert := assert.New(t)
+	base := []byte{1, 2, 3}
+	m := NewMocker(map[Identifier64]map[Identifier64][]byte{
+		0x11: {5: base},
+	})
+	m.LoadRoot(0x11).LoadChild(5)
+
+	m.Save()
+	writeByte(m, 0, 10)
+	assert.Equal([]byte{10, 2, 3}, m.current)
+	assert.Equal([]byte{1, 2, 3}, base, "underlying chunk must not be modified before commit")
+
+	m.Save()
+	writeByte(m, 1, 20)
+	writeByte(m, 4, 40)
+	assert.Equal([]byte{10, 20, 3, 0, 40}, m.current)
+
+	m.Restore()
+	assert.Equal([]byte{10, 2, 3}, m.current)
+
+	m.Save()
+	writeByte(m, 2, 30)
+	m.Discard()
+	assert.Equal([]byte{10, 2, 30}, m.current)
+	assert.Equal([]byte{1, 2, 3}, base)
+
+	m.Discard()
+	assert.Empty(m.checkpoints)
+	assert.Equal([]byte{10, 2, 30}, m.changes[ChunkID{0x11, 5}])
+	assert.Equal([]byte{1, 2, 3}, base)
+}
+
+func TestModule_RestoreNewChunk(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMocker(nil)
+
+	m.Save()
+	m.LoadRoot(0x12).LoadChild(7)
+	assert.Nil(m.current)
+
+	m.Save()
+	writeByte(m, 3, 9)
+	assert.Equal([]byte{0, 0, 0, 9}, m.current)
+
+	m.Restore()
+	assert.Nil(m.current)
+	m.Discard()
+	assert.Empty(m.changes)
+
+	m.Save()
+	m.LoadRoot(0x12).LoadChild(7)
+	writeByte(m, 0, 1)
+	m.Discard()
+	assert.Equal([]byte{1}, m.changes[ChunkID{0x12, 7}])
+}
+
+func TestModule_CopyOnWrite(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMocker(map[Identifier64]map[Identifier64][]byte{
+		0x11: {1: {1, 1}, 2: {2, 2}},
+	})
+
+	m.Save()
+	m.LoadRoot(0x11).LoadChild(1)
+	writeByte(m, 0, 5)
+	m.LoadChild(2)
+	assert.Len(m.checkpoints[0], 1, "only modified chunks should be copied")
+
+	m.Save()
+	m.LoadChild(1)
+	assert.False(m.isWritable)
+	writeByte(m, 1, 6)
+	assert.True(m.isWritable)
+	assert.Equal([]byte{5, 1}, m.checkpoints[0][ChunkID{0x11, 1}])
+	assert.Equal([]byte{5, 6}, m.checkpoints[1][ChunkID{0x11, 1}])
+
+	assert.Panics(func() { m.prepareWrite(MaxChunkSize + 1) })
+	m.LoadRoot(0x11)
+	assert.Panics(func() { m.prepareWrite(1) })
+}
+
+func TestModule_NoCheckpoint(t *testing.T) {
+	m := NewMocker(nil)
+	assert.PanicsWithValue(t, ErrNoCheckpoint, func() { m.Restore() })
+	assert.PanicsWithValue(t, ErrNoCheckpoint, func() { m.Discard() })
+
+	m.Save()
+	m.Discard()
+	assert.PanicsWithValue(t, ErrNoCheckpoint, func() { m.Discard() })
+}
+
+func TestModule_Poison(t *testing.T) {
+	chunks := map[Identifier64]map[Identifier64][]byte{}
+	m := NewMocker(chunks)
+	m.LoadRoot(0x11).LoadChild(1)
+	writeByte(m, 0, 1)
+	m.Poison()
+	assert.Equal(t, ErrPoisoned, m.Commit())
+	assert.Empty(t, chunks, "a poisoned module must not change the store")
+}
+
+type failingStore struct {
+	*MapStore
+}
+
+func (s failingStore) Get(Identifier64, Identifier64) ([]byte, error) {
+	return nil, errors.New("disk failure")
+}
+
+func TestModule_Fetch(t *testing.T) {
+	m := NewMocker(map[Identifier64]map[Identifier64][]byte{
+		0x11: {1: {1, 1, 1}, 2: {2}},
+	})
+	m.LoadRoot(0x11).LoadChild(2)
+	size, err := m.Fetch(0x11, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), size)
+	assert.Equal(t, int64(1), m.ChunkSize(), "Fetch must not change the current chunk")
+	size, err = m.Fetch(0x11, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+
+	m = New(failingStore{NewMapStore(nil)})
+	_, err = m.Fetch(0x11, 1)
+	assert.EqualError(t, err, "disk failure")
+	assert.Panics(t, func() { m.LoadRoot(0x11).LoadChild(1) })
+}
+
+type countingStore struct {
+	*MapStore
+	reads []ChunkID
+}
+
+func (s *countingStore) Get(root, child Identifier64) ([]byte, error) {
+	s.reads = append(s.reads, ChunkID{root, child})
+	return s.MapStore.Get(root, child)
+}
+
+func TestModule_Commit(t *testing.T) {
+	assert := assert.New(t)
+	chunks := map[Identifier64]map[Identifier64][]byte{
+		0x11: {1: {1, 1}, 2: {2, 2}, 3: {3, 3}},
+	}
+	store := &countingStore{MapStore: NewMapStore(chunks)}
+	m := New(store)
+
+	m.Save()
+	m.LoadRoot(0x11)
+	assert.Empty(store.reads, "loading a root should not read any chunks")
+	m.LoadChild(1)
+	writeByte(m, 0, 5)
+	m.LoadChild(2)
+	m.DeleteChunk()
+	m.LoadChild(1)
+	assert.Equal([]ChunkID{{0x11, 1}, {0x11, 2}}, store.reads, "chunks should be read lazily and only once")
+
+	assert.Equal(ErrOpenCheckpoint, m.Commit())
+	m.Discard()
+	assert.Equal([]byte{1, 1}, chunks[0x11][1], "the store should not be modified before commit")
+
+	assert.NoError(m.Commit())
+	assert.Equal(map[Identifier64]map[Identifier64][]byte{
+		0x11: {1: {5, 1}, 3: {3, 3}},
+	}, chunks)
+
+	writeByte(m, 1, 6)
+	assert.Equal([]byte{5, 1}, chunks[0x11][1], "committed chunks should not be modified in place")
+	m.LoadChild(2)
+	assert.Equal(int64(0), m.ChunkSize())
+}
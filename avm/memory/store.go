@@ -0,0 +1,106 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package memory
+
+import (
+	"errors"
+	. "go-AVM/avm/prefix"
+	"sort"
+)
+
+var ErrChunkNotFound = errors.New("memory: chunk not found")
+
+// ChunkStore is the storage backend of a Module. Chunks are keyed by the
+// identifier of their root and their identifier under that root.
+//
+// Get returns ErrChunkNotFound when the chunk does not exist. The returned
+// slice may be shared with the store and must not be modified. Put takes the
+// ownership of `chunk`, and the caller must not modify it afterwards.
+//
+// A Module only calls Put and Delete from Commit. If a store also implements
+// Committer, its Commit method is called after all the changes of a Module
+// are passed to the store.
+type ChunkStore interface {
+	Get(root, child Identifier64) ([]byte, error)
+	Put(root, child Identifier64, chunk []byte) error
+	Delete(root, child Identifier64) error
+}
+
+// Committer is implemented by stores that can apply a batch of changes
+// atomically.
+type Committer interface {
+	Commit() error
+}
+
+// MapStore is an in-memory ChunkStore.
+type MapStore struct {
+	chunks map[Identifier64]map[Identifier64][]byte
+}
+
+// NewMapStore creates a MapStore that uses `chunks` for storing chunks. The
+// map will be modified by Put and Delete. `chunks` can be nil.
+func NewMapStore(chunks map[Identifier64]map[Identifier64][]byte) *MapStore {
+	if chunks == nil {
+		chunks = map[Identifier64]map[Identifier64][]byte{}
+	}
+	return &MapStore{chunks: chunks}
+}
+
+func (s *MapStore) Get(root, child Identifier64) ([]byte, error) {
+	chunk, exists := s.chunks[root][child]
+	if !exists {
+		return nil, ErrChunkNotFound
+	}
+	return chunk, nil
+}
+
+func (s *MapStore) Put(root, child Identifier64, chunk []byte) error {
+	r := s.chunks[root]
+	if r == nil {
+		r = map[Identifier64][]byte{}
+		s.chunks[root] = r
+	}
+	r[child] = chunk
+	return nil
+}
+
+func (s *MapStore) Delete(root, child Identifier64) error {
+	r := s.chunks[root]
+	delete(r, child)
+	if len(r) == 0 {
+		delete(s.chunks, root)
+	}
+	return nil
+}
+
+// ForEach calls `f` for every chunk in a deterministic order.
+func (s *MapStore) ForEach(f func(id ChunkID, chunk []byte) error) error {
+	var ids []ChunkID
+	for root, children := range s.chunks {
+		for child := range children {
+			ids = append(ids, ChunkID{root, child})
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	for _, id := range ids {
+		if err := f(id, s.chunks[id.Root][id.Child]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
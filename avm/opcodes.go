@@ -0,0 +1,235 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import "sort"
+
+// InstructionInfo describes an instruction of the AVM.
+//
+// Operands describes the immediate operands of the instruction, which are
+// stored in the method area after the opcode. It is a space separated list
+// of operand formats, where every format is a kind followed by a size in
+// bits:
+//		i   signed integer
+//		u   unsigned integer
+//		b   raw bytes
+//		o   signed branch offset, relative to the end of the instruction
+// A trailing `*` means that the operand is repeated as many times as the
+// value of the first operand of the instruction. For example, the format of
+// jmpTable is "u16 o32 o32*". All integers are little-endian.
+type InstructionInfo struct {
+	Opcode   Opcode
+	Name     string
+	Operands string
+}
+
+type instruction struct {
+	opcode   Opcode
+	name     string
+	operands string
+	routine  func(*Processor)
+}
+
+// instructionSet is the list of all defined instructions. Any opcode that is
+// not in this list is an invalid opcode.
+var instructionSet = []instruction{
+	{0x00, "noOp", "", (*Processor).noOp},
+	{0x01, "invokeDispatcher", "", (*Processor).invokeDispatcher},
+	{0x02, "indInvokeDispatcher", "", (*Processor).indInvokeDispatcher},
+	{0x03, "spawnDispatcher", "", (*Processor).spawnDispatcher},
+	{0x04, "invokeInternal", "", (*Processor).invokeInternal},
+	{0x05, "indInvokeInternal", "", (*Processor).indInvokeInternal},
+	{0x06, "emitC16", "u16", (*Processor).emitC16},
+	{0x07, "errCode", "", (*Processor).errCode},
+	{0x08, "ret0", "", (*Processor).ret0},
+	{0x09, "ret64", "", (*Processor).ret64},
+	{0x0a, "errData", "", (*Processor).errData},
+	{0x0b, "throw", "", (*Processor).throw},
+	{0x0c, "enter", "", (*Processor).enter},
+	{0x0d, "lfStoreErrData", "", (*Processor).lfStoreErrData},
+	{0x10, "pushC64", "i64", (*Processor).pushC64},
+	{0x11, "pop", "", (*Processor).pop},
+	{0x12, "iAdd", "", (*Processor).iAdd},
+	{0x13, "iSub", "", (*Processor).iSub},
+	{0x14, "argC16", "u16", (*Processor).argC16},
+	{0x15, "lfLoadC16", "u16", (*Processor).lfLoadC16},
+	{0x16, "lfStoreC16", "u16", (*Processor).lfStoreC16},
+	{0x17, "jmpEqC16", "o16", (*Processor).jmpEqC16},
+	{0x20, "hLoadLocal", "", (*Processor).hLoadLocal},
+	{0x21, "hUnLoadLocal", "", (*Processor).hUnLoadLocal},
+	{0x22, "hLoad8", "", (*Processor).hLoad8},
+	{0x23, "hLoad16", "", (*Processor).hLoad16},
+	{0x24, "hLoad32", "", (*Processor).hLoad32},
+	{0x25, "hLoad64", "", (*Processor).hLoad64},
+	{0x26, "hStore8", "", (*Processor).hStore8},
+	{0x27, "hStore16", "", (*Processor).hStore16},
+	{0x28, "hStore32", "", (*Processor).hStore32},
+	{0x29, "hStore64", "", (*Processor).hStore64},
+	{0x2a, "hLoadBytesC16", "u16", (*Processor).hLoadBytesC16},
+	{0x2b, "hStoreBytesC16", "u16", (*Processor).hStoreBytesC16},
+	{0x30, "iMul", "", (*Processor).iMul},
+	{0x31, "iDiv", "", (*Processor).iDiv},
+	{0x32, "iRem", "", (*Processor).iRem},
+	{0x33, "iNeg", "", (*Processor).iNeg},
+	{0x34, "iAbs", "", (*Processor).iAbs},
+	{0x35, "iMin", "", (*Processor).iMin},
+	{0x36, "iMax", "", (*Processor).iMax},
+	{0x37, "uDiv", "", (*Processor).uDiv},
+	{0x38, "uRem", "", (*Processor).uRem},
+	{0x39, "uMin", "", (*Processor).uMin},
+	{0x3a, "uMax", "", (*Processor).uMax},
+	{0x3b, "iAddChk", "", (*Processor).iAddChk},
+	{0x3c, "iSubChk", "", (*Processor).iSubChk},
+	{0x3d, "iMulChk", "", (*Processor).iMulChk},
+	{0x3e, "iNegChk", "", (*Processor).iNegChk},
+	{0x3f, "iAbsChk", "", (*Processor).iAbsChk},
+	{0x40, "uAddChk", "", (*Processor).uAddChk},
+	{0x41, "uSubChk", "", (*Processor).uSubChk},
+	{0x42, "uMulChk", "", (*Processor).uMulChk},
+	{0x50, "and", "", (*Processor).and},
+	{0x51, "or", "", (*Processor).or},
+	{0x52, "xor", "", (*Processor).xor},
+	{0x53, "not", "", (*Processor).not},
+	{0x54, "shl", "", (*Processor).shl},
+	{0x55, "shr", "", (*Processor).shr},
+	{0x56, "sar", "", (*Processor).sar},
+	{0x57, "rotl", "", (*Processor).rotl},
+	{0x58, "rotr", "", (*Processor).rotr},
+	{0x59, "popCnt", "", (*Processor).popCnt},
+	{0x5a, "clz", "", (*Processor).clz},
+	{0x5b, "ctz", "", (*Processor).ctz},
+	{0x60, "eq", "", (*Processor).eq},
+	{0x61, "ne", "", (*Processor).ne},
+	{0x62, "iLt", "", (*Processor).iLt},
+	{0x63, "iLe", "", (*Processor).iLe},
+	{0x64, "iGt", "", (*Processor).iGt},
+	{0x65, "iGe", "", (*Processor).iGe},
+	{0x66, "uLt", "", (*Processor).uLt},
+	{0x67, "uLe", "", (*Processor).uLe},
+	{0x68, "uGt", "", (*Processor).uGt},
+	{0x69, "uGe", "", (*Processor).uGe},
+	{0x70, "jmpC16", "o16", (*Processor).jmpC16},
+	{0x71, "jmpNeC16", "o16", (*Processor).jmpNeC16},
+	{0x72, "jmpLtC16", "o16", (*Processor).jmpLtC16},
+	{0x73, "jmpGeC16", "o16", (*Processor).jmpGeC16},
+	{0x74, "jmpULtC16", "o16", (*Processor).jmpULtC16},
+	{0x75, "jmpUGeC16", "o16", (*Processor).jmpUGeC16},
+	{0x76, "jmpZC16", "o16", (*Processor).jmpZC16},
+	{0x77, "jmpNzC16", "o16", (*Processor).jmpNzC16},
+	{0x78, "jmpC32", "o32", (*Processor).jmpC32},
+	{0x79, "jmpEqC32", "o32", (*Processor).jmpEqC32},
+	{0x7a, "jmpNeC32", "o32", (*Processor).jmpNeC32},
+	{0x7b, "jmpLtC32", "o32", (*Processor).jmpLtC32},
+	{0x7c, "jmpGeC32", "o32", (*Processor).jmpGeC32},
+	{0x7d, "jmpULtC32", "o32", (*Processor).jmpULtC32},
+	{0x7e, "jmpUGeC32", "o32", (*Processor).jmpUGeC32},
+	{0x7f, "jmpZC32", "o32", (*Processor).jmpZC32},
+	{0x80, "jmpNzC32", "o32", (*Processor).jmpNzC32},
+	{0x81, "jmpTable", "u16 o32 o32*", (*Processor).jmpTable},
+	{0x90, "fAdd", "", (*Processor).fAdd},
+	{0x91, "fSub", "", (*Processor).fSub},
+	{0x92, "fMul", "", (*Processor).fMul},
+	{0x93, "fDiv", "", (*Processor).fDiv},
+	{0x94, "fSqrt", "", (*Processor).fSqrt},
+	{0x95, "fNeg", "", (*Processor).fNeg},
+	{0x96, "fAbs", "", (*Processor).fAbs},
+	{0x97, "fEq", "", (*Processor).fEq},
+	{0x98, "fNe", "", (*Processor).fNe},
+	{0x99, "fLt", "", (*Processor).fLt},
+	{0x9a, "fLe", "", (*Processor).fLe},
+	{0x9b, "fGt", "", (*Processor).fGt},
+	{0x9c, "fGe", "", (*Processor).fGe},
+	{0x9d, "iToF", "", (*Processor).iToF},
+	{0x9e, "fToI", "", (*Processor).fToI},
+	{0x9f, "fTruncC8", "u8", (*Processor).fTruncC8},
+	{0xa0, "dAddC8", "u8 u8", (*Processor).dAddC8},
+	{0xa1, "dSubC8", "u8 u8", (*Processor).dSubC8},
+	{0xa2, "dMulC8", "u8 u8", (*Processor).dMulC8},
+	{0xa3, "dDivC8", "u8 u8", (*Processor).dDivC8},
+	{0xa4, "dRescaleC8", "u8 u8 u8", (*Processor).dRescaleC8},
+	{0xa8, "u256Add", "", (*Processor).u256Add},
+	{0xa9, "u256Sub", "", (*Processor).u256Sub},
+	{0xaa, "u256Mul", "", (*Processor).u256Mul},
+	{0xab, "u256Div", "", (*Processor).u256Div},
+	{0xac, "u256Mod", "", (*Processor).u256Mod},
+	{0xad, "i256Div", "", (*Processor).i256Div},
+	{0xae, "i256Mod", "", (*Processor).i256Mod},
+	{0xaf, "u256AddMod", "", (*Processor).u256AddMod},
+	{0xb0, "u256MulMod", "", (*Processor).u256MulMod},
+	{0xb1, "u256Exp", "", (*Processor).u256Exp},
+	{0xb2, "u256Eq", "", (*Processor).u256Eq},
+	{0xb3, "u256Lt", "", (*Processor).u256Lt},
+	{0xb4, "u256Gt", "", (*Processor).u256Gt},
+	{0xb5, "i256Lt", "", (*Processor).i256Lt},
+	{0xb6, "i256Gt", "", (*Processor).i256Gt},
+	{0xb7, "u256IsZero", "", (*Processor).u256IsZero},
+	{0xb8, "u256And", "", (*Processor).u256And},
+	{0xb9, "u256Or", "", (*Processor).u256Or},
+	{0xba, "u256Xor", "", (*Processor).u256Xor},
+	{0xbb, "u256Not", "", (*Processor).u256Not},
+	{0xbc, "i256Neg", "", (*Processor).i256Neg},
+	{0xbd, "u256Shl", "", (*Processor).u256Shl},
+	{0xbe, "u256Shr", "", (*Processor).u256Shr},
+	{0xbf, "i256Sar", "", (*Processor).i256Sar},
+	{0xc0, "u256FromU64", "", (*Processor).u256FromU64},
+	{0xc1, "i256FromI64", "", (*Processor).i256FromI64},
+	{0xc2, "u256ToU64", "", (*Processor).u256ToU64},
+	{0xc3, "i256ToI64", "", (*Processor).i256ToI64},
+	{0xc8, "dup", "", (*Processor).dup},
+	{0xc9, "dupC8", "u8", (*Processor).dupC8},
+	{0xca, "swap", "", (*Processor).swap},
+	{0xcb, "swapC8", "u8", (*Processor).swapC8},
+	{0xcc, "over", "", (*Processor).over},
+	{0xcd, "rot", "", (*Processor).rot},
+	{0xce, "dropC8", "u8", (*Processor).dropC8},
+	{0xcf, "pickC16", "u16", (*Processor).pickC16},
+	{0xd0, "rollC16", "u16", (*Processor).rollC16},
+	{0xd8, "pushC8", "i8", (*Processor).pushC8},
+	{0xd9, "pushC16", "i16", (*Processor).pushC16},
+	{0xda, "pushC32", "i32", (*Processor).pushC32},
+	{0xdb, "pushUC8", "u8", (*Processor).pushUC8},
+	{0xdc, "pushUC16", "u16", (*Processor).pushUC16},
+	{0xdd, "pushUC32", "u32", (*Processor).pushUC32},
+	{0xde, "lfLoadC8", "u8", (*Processor).lfLoadC8},
+	{0xdf, "lfStoreC8", "u8", (*Processor).lfStoreC8},
+	{0xe0, "lfLoad8C16", "u16", (*Processor).lfLoad8C16},
+	{0xe1, "lfLoad16C16", "u16", (*Processor).lfLoad16C16},
+	{0xe2, "lfLoad32C16", "u16", (*Processor).lfLoad32C16},
+	{0xe3, "lfStore8C16", "u16", (*Processor).lfStore8C16},
+	{0xe4, "lfStore16C16", "u16", (*Processor).lfStore16C16},
+	{0xe5, "lfStore32C16", "u16", (*Processor).lfStore32C16},
+	{0xe6, "lfLoad", "", (*Processor).lfLoad},
+	{0xe7, "lfLoad8", "", (*Processor).lfLoad8},
+	{0xe8, "lfLoad16", "", (*Processor).lfLoad16},
+	{0xe9, "lfLoad32", "", (*Processor).lfLoad32},
+	{0xea, "lfStore", "", (*Processor).lfStore},
+	{0xeb, "lfStore8", "", (*Processor).lfStore8},
+	{0xec, "lfStore16", "", (*Processor).lfStore16},
+	{0xed, "lfStore32", "", (*Processor).lfStore32},
+}
+
+// Instructions returns the list of all defined instructions sorted by their
+// opcodes.
+func Instructions() []InstructionInfo {
+	list := make([]InstructionInfo, len(instructionSet))
+	for i, ins := range instructionSet {
+		list[i] = InstructionInfo{ins.opcode, ins.name, ins.operands}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Opcode < list[j].Opcode })
+	return list
+}
@@ -33,23 +33,6 @@ const (
 	MaxCallStackDepth     = 1024
 )
 
-type ErrorCode int
-
-const (
-	NoError ErrorCode = iota
-	InvalidOperands
-	InvalidSpawnState
-	SoftwareError
-	InvalidReference
-	MemoryLimitExceeded
-	MaxCallStackDepthExceeded
-	OverFlow
-	UnderFlow
-	PrecisionLoss
-	Reentrancy
-	RuntimeError
-)
-
 type CallInfo struct {
 	pc       int64
 	context  prefix.Identifier64
@@ -58,23 +41,40 @@ type CallInfo struct {
 		localID prefix.Identifier64
 	}
 	isIndependent bool
-	entranceLock  *bool
-	operandStack  *dynamicArray
-	localFrame    *dynamicArray
+	// the heap chunk selected by hLoadLocal, it will be reloaded when the
+	// call becomes the current call again
+	heapChunk    prefix.Identifier64
+	hasHeapChunk bool
+	entranceLock *bool
+	operandStack *dynamicArray
+	localFrame   *dynamicArray
 }
 
 type Processor struct {
 	callStackQueue [][]*CallInfo
 	current        *CallInfo
 	errorStatus    ErrorCode
+	// the bytes thrown by the last call, if it failed
+	errorData      []byte
 	entranceLocks  map[prefix.Identifier64]*bool
 	nextLocalFrame *dynamicArray
 	returnData     []byte
 	heap           *memory.Module
 	methodArea     *memory.Module
+	gas            *gasMeter
+	gasLimit       uint64
+	// events emitted by the session, and for every open heap checkpoint the
+	// number of events emitted before it
+	events     []Event
+	eventMarks []int
+	touched    map[memory.ChunkID]bool
+	failure    *Failure
+	// the pc of the current instruction
+	instructionPC    int64
+	instructionCount uint64
 }
 
-func newProcessor(nextLocalFrame *dynamicArray, heap, methodArea *memory.Module) *Processor {
+func newProcessor(nextLocalFrame *dynamicArray, heap, methodArea *memory.Module, gas *gasMeter) *Processor {
 	return &Processor{
 		callStackQueue: [][]*CallInfo{{}},
 		errorStatus:    NoError,
@@ -82,6 +82,9 @@ func newProcessor(nextLocalFrame *dynamicArray, heap, methodArea *memory.Module)
 		nextLocalFrame: nextLocalFrame,
 		heap:           heap,
 		methodArea:     methodArea,
+		gas:            gas,
+		gasLimit:       gas.remaining,
+		touched:        map[memory.ChunkID]bool{},
 	}
 }
 
@@ -92,39 +95,77 @@ func (p *Processor) newCallInfo(context, app, method prefix.Identifier64) *CallI
 			appID   prefix.Identifier64
 			localID prefix.Identifier64
 		}{app, method},
-		operandStack: newOperandStack(),
+		operandStack: newOperandStack(p.gas),
 		localFrame:   p.nextLocalFrame,
 	}
 }
 
-func (p *Processor) callMethod(context, app, method prefix.Identifier64) {
+// storeFailure is raised when a chunk store fails. The session is terminated
+// with StorageError.
+type storeFailure struct {
+	err error
+}
+
+// fetchChunk reads a chunk from the store and returns its size. Chunks must be
+// fetched before any state is changed, so a store failure never happens in
+// the middle of updating the state.
+func (p *Processor) fetchChunk(m *memory.Module, root, child prefix.Identifier64) int64 {
+	size, err := m.Fetch(root, child)
+	if err != nil {
+		panic(storeFailure{err})
+	}
+	return size
+}
+
+// callMethod pushes a new call onto the call stack. A method without any
+// code does not exist, and calling it raises InvalidReference. The error is
+// raised after the call is pushed, so an independent call can be used for
+// handling it.
+func (p *Processor) callMethod(context, app, method prefix.Identifier64, independent bool) {
 	if len(p.callStackQueue[0]) == MaxCallStackDepth {
 		panic(MaxCallStackDepthExceeded)
 	}
+	size := p.fetchChunk(p.methodArea, app, method)
 	p.callStackQueue[0] = append(p.callStackQueue[0], p.newCallInfo(context, app, method))
 	p.updateCurrentCallContext()
 	p.errorStatus = NoError
+	p.errorData = nil
+	if independent {
+		p.current.isIndependent = true
+		p.save()
+	}
+	if size == 0 {
+		panic(InvalidReference)
+	}
 }
 
 func (p *Processor) updateCurrentCallContext() {
-	// This function MUST NOT panic
+	// This function MUST NOT panic. The chunks of a call are fetched before
+	// the call is pushed, so loading them never reads the store.
 	if p.callStackQueue == nil {
 		p.current = nil
 		p.nextLocalFrame = nil
 		return
 	}
 	p.current = p.callStackQueue[0][len(p.callStackQueue[0])-1]
-	p.nextLocalFrame = newLocalFrame()
+	p.nextLocalFrame = newLocalFrame(p.gas)
 	p.heap.LoadRoot(p.current.context)
+	if p.current.hasHeapChunk {
+		p.heap.LoadChild(p.current.heapChunk)
+	}
 	p.methodArea.LoadRoot(p.current.methodID.appID).LoadChild(p.current.methodID.localID)
 }
 
 func (p *Processor) returnBytes(n int64, status ErrorCode) {
 	// important: this function may panic when n > 0, but it should not panic when n == 0. When it panics
 	// it must not change any state or have any effects
+	isNewQueue := false
 	if top := len(p.callStackQueue[0]); top <= 1 {
 		if n > 0 {
 			l := p.current.operandStack.length()
+			if l < n {
+				panic(StackUnderflow)
+			}
 			p.returnData = append(p.returnData, p.current.operandStack.content[l-n:l]...)
 		}
 		// update the call stack queue
@@ -133,6 +174,7 @@ func (p *Processor) returnBytes(n int64, status ErrorCode) {
 		} else {
 			p.callStackQueue[0] = nil
 			p.callStackQueue = p.callStackQueue[1:]
+			isNewQueue = true
 		}
 	} else {
 		nextCallInfo := p.callStackQueue[0][top-2]
@@ -140,7 +182,7 @@ func (p *Processor) returnBytes(n int64, status ErrorCode) {
 			// `ensureLen()` changes the state of the caller's stack, so before calling it, first we should make
 			// sure that binary.CopyBytes won't panic
 			if p.current.operandStack.length() < n {
-				panic(InvalidOperands)
+				panic(StackUnderflow)
 			}
 			callerStackTop := nextCallInfo.operandStack.length()
 			nextCallInfo.operandStack.ensureLen(callerStackTop + n)
@@ -156,15 +198,31 @@ func (p *Processor) returnBytes(n int64, status ErrorCode) {
 		*p.current.entranceLock = false
 	}
 	p.errorStatus = status
+	p.errorData = nil
 	if status != NoError {
-		p.heap.Restore()
+		if n > 0 {
+			// the current call has not been updated yet and its stack still contains the thrown bytes
+			l := p.current.operandStack.length()
+			p.errorData = append([]byte(nil), p.current.operandStack.content[l-n:l]...)
+		}
+		p.restore()
 	} else if p.current.isIndependent || p.callStackQueue == nil {
-		p.heap.Discard()
+		p.discard()
+	}
+	if isNewQueue {
+		// spawned calls are independent and their changes must be revertible
+		p.save()
 	}
 	p.updateCurrentCallContext()
 }
 
 func (p *Processor) throwBytes(n int64, code ErrorCode) {
+	p.failure = &Failure{
+		App:       p.current.methodID.appID,
+		Method:    p.current.methodID.localID,
+		PC:        p.instructionPC,
+		CallDepth: len(p.callStackQueue[0]),
+	}
 	ic := p.findIndependentCaller()
 	for i := ic + 1; i < len(p.callStackQueue[0]); i++ {
 		if p.callStackQueue[0][i].entranceLock != nil {
@@ -185,10 +243,91 @@ func (p *Processor) findIndependentCaller() int {
 	return 0
 }
 
+// abort terminates the session with an error that can not be caught by
+// applications, like InternalError. All the changes of the session are
+// reverted.
+//
+// abort is called when the state of the processor may be inconsistent, so
+// it does not use the normal unwinding mechanism of calls and it never
+// panics.
+func (p *Processor) abort(code ErrorCode) {
+	// every independent call of a running session has an open checkpoint
+	checkpoints := -1
+	if p.current != nil {
+		checkpoints = 0
+		for _, callInfo := range p.callStackQueue[0] {
+			if callInfo.isIndependent {
+				checkpoints++
+			}
+		}
+		p.failure = &Failure{
+			App:       p.current.methodID.appID,
+			Method:    p.current.methodID.localID,
+			PC:        p.instructionPC,
+			CallDepth: len(p.callStackQueue[0]),
+		}
+	}
+	for _, callStack := range p.callStackQueue {
+		for _, callInfo := range callStack {
+			if callInfo != nil && callInfo.entranceLock != nil {
+				*callInfo.entranceLock = false
+			}
+		}
+	}
+	p.callStackQueue = nil
+	p.errorStatus = code
+	p.errorData = nil
+	p.updateCurrentCallContext()
+	if checkpoints >= 0 {
+		p.restoreAll(checkpoints)
+	}
+}
+
+// restoreAll reverts the open checkpoints of an aborted session, which must
+// have exactly `n` checkpoints. If the changes of the session can not be
+// reverted, the heap is poisoned, so they will never be committed.
+func (p *Processor) restoreAll(n int) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.heap.Poison()
+		}
+	}()
+	if len(p.eventMarks) != n {
+		p.heap.Poison()
+	}
+	for len(p.eventMarks) > 0 {
+		p.restore()
+	}
+}
+
+// save creates a heap checkpoint. Events are reverted together with the
+// heap, so save, restore and discard must be used instead of calling the
+// heap directly.
+func (p *Processor) save() {
+	p.heap.Save()
+	p.eventMarks = append(p.eventMarks, len(p.events))
+}
+
+func (p *Processor) restore() {
+	p.heap.Restore()
+	last := len(p.eventMarks) - 1
+	p.events = p.events[:p.eventMarks[last]]
+	p.eventMarks = p.eventMarks[:last]
+}
+
+func (p *Processor) discard() {
+	p.heap.Discard()
+	p.eventMarks = p.eventMarks[:len(p.eventMarks)-1]
+}
+
 func (p *Processor) nextOpcode() (Opcode, bool) {
 	if p.current == nil {
 		return 0, true
 	}
+	p.instructionPC = p.current.pc
+	if p.current.pc < 0 || p.current.pc >= p.methodArea.ChunkSize() {
+		panic(PcOutOfRange)
+	}
 	opcode := Opcode(p.methodArea.LoadByte(p.current.pc))
 	p.current.pc++
 	return opcode, false
@@ -18,29 +18,57 @@
 package avm
 
 import (
-	"fmt"
+	"github.com/stretchr/testify/assert"
 	"go-AVM/avm/binary"
 	"math"
 	"testing"
 )
 
-const Log10 = 3.321928
-
-func TestFloat(t *testing.T) {
+func TestFloat_AdditionLoss(t *testing.T) {
 	f1 := 100000000000.123
 	f2 := 125.33333333333333333
-	a := math.Float64bits(f1)
-	b := math.Float64bits(f2)
-	bt := truncate(b, int(math.Ceil(Log10*4)))
-	fmt.Printf("ft: %v \n", math.Float64frombits(bt))
-	fmt.Printf("%v\n", add(a, bt))
-	fmt.Printf("%v", f1+f2)
+	assert.PanicsWithValue(t, PrecisionLoss, func() { fpAdd(f1, f2) })
+	assert.PanicsWithValue(t, PrecisionLoss, func() { fpSub(f2, f1) })
+
+	// keeping 14 fractional bits: 4 decimal digits
+	truncated := math.Float64frombits(truncate(math.Float64bits(f2), 14))
+	assert.Equal(t, 125.3333, math.Floor(truncated*10000)/10000)
+	assert.Equal(t, f1+truncated, fpAdd(f1, truncated))
+	assert.Equal(t, f1-truncated, fpSub(f1, truncated))
+
+	assert.Equal(t, 1.5, fpAdd(1, 0.5))
+	assert.Equal(t, f2, fpAdd(0, f2))
+	assert.PanicsWithValue(t, UnderFlow, func() { fpAdd(0x1p-1074, 0x1p-1074) })
+	assert.PanicsWithValue(t, UnderFlow, func() { fpSub(0x1.8p-1022, 0x1p-1022) })
+	assert.PanicsWithValue(t, UnderFlow, func() { fpAdd(-0x1p-1022, 0x1p-1074) })
+	assert.Equal(t, 0x1p-1021, fpAdd(0x1p-1022, 0x1p-1022))
+	assert.Equal(t, 0.0, fpSub(0x1p-1022, 0x1p-1022), "an exact zero is not an underflow")
+}
+
+func TestFloat_Truncate(t *testing.T) {
+	tests := []struct {
+		f    float64
+		n    int
+		want float64
+	}{
+		{2.75, 1, 2.5},
+		{-2.75, 1, -2.5},
+		{2.75, 2, 2.75},
+		{2.75, 0, 2},
+		{0.25, 1, 0},
+		{-0.25, 1, math.Copysign(0, -1)},
+		{1e300, 0, 1e300},
+	}
+	for _, test := range tests {
+		got := math.Float64frombits(truncate(math.Float64bits(test.f), test.n))
+		assert.Equal(t, math.Float64bits(test.want), math.Float64bits(got), "truncate(%v, %d)", test.f, test.n)
+	}
 }
 
 func BenchmarkProcessor_iAdd64(b *testing.B) {
 	p := Processor{}
 	p.current = &CallInfo{
-		operandStack: newOperandStack(),
+		operandStack: newOperandStack(newGasMeter(math.MaxUint64, DefaultGasSchedule())),
 	}
 
 	b.ResetTimer()
@@ -55,7 +83,7 @@ func BenchmarkProcessor_iAdd64(b *testing.B) {
 func BenchmarkProcessor_iAdd64NoFunc(b *testing.B) {
 	p := Processor{}
 	p.current = &CallInfo{
-		operandStack: newOperandStack(),
+		operandStack: newOperandStack(newGasMeter(math.MaxUint64, DefaultGasSchedule())),
 	}
 
 	b.ResetTimer()
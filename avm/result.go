@@ -0,0 +1,59 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import (
+	"go-AVM/avm/memory"
+	"go-AVM/avm/prefix"
+)
+
+// Result is the result of executing a session.
+//
+// Events are the events that were emitted by the session and were not
+// reverted. TouchedChunks contains all the heap chunks that were selected by
+// the session, including the chunks of the calls that failed. It is sorted
+// by the root identifier and then by the child identifier. Failure describes
+// the instruction that caused the error of the session and is nil when the
+// session ended without any error.
+type Result struct {
+	ReturnData       []byte
+	Error            ErrorCode
+	Failure          *Failure
+	GasUsed          uint64
+	InstructionCount uint64
+	Events           []Event
+	TouchedChunks    []memory.ChunkID
+}
+
+// Failure describes where an error was raised. PC is the position of the
+// failing instruction in its method and CallDepth is the depth of the call
+// stack at the time of the failure, where the first called method has the
+// depth 1.
+type Failure struct {
+	App       prefix.Identifier64
+	Method    prefix.Identifier64
+	PC        int64
+	CallDepth int
+}
+
+// Event is an event emitted by the emitC16 instruction. App is the
+// application whose context emitted the event.
+type Event struct {
+	App  prefix.Identifier64
+	Data []byte
+}
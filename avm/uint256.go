@@ -0,0 +1,318 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import "math/bits"
+
+// uint256 is a 256-bit integer made of four 64-bit limbs, from the least
+// significant to the most significant. On the operand stack a uint256
+// occupies 32 bytes and is stored in little-endian. Signed operations
+// interpret a uint256 as a two's complement integer.
+//
+// All functions of this file work on values and fixed size arrays, so they
+// do not allocate memory.
+type uint256 [4]uint64
+
+func (x uint256) isZero() bool {
+	return x[0]|x[1]|x[2]|x[3] == 0
+}
+
+func (x uint256) isNegative() bool {
+	return int64(x[3]) < 0
+}
+
+func (x uint256) add(y uint256) (z uint256, carry uint64) {
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], carry = bits.Add64(x[3], y[3], carry)
+	return
+}
+
+func (x uint256) sub(y uint256) (z uint256) {
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], _ = bits.Sub64(x[3], y[3], borrow)
+	return
+}
+
+func (x uint256) neg() uint256 {
+	return uint256{}.sub(x)
+}
+
+func (x uint256) abs() uint256 {
+	if x.isNegative() {
+		return x.neg()
+	}
+	return x
+}
+
+// mulFull returns the 512-bit product of `x` and `y`.
+func (x uint256) mulFull(y uint256) (z [8]uint64) {
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, z[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			z[i+j] = lo
+			carry = hi
+		}
+		z[i+4] = carry
+	}
+	return
+}
+
+func (x uint256) mul(y uint256) (z uint256) {
+	p := x.mulFull(y)
+	copy(z[:], p[:4])
+	return
+}
+
+func (x uint256) cmp(y uint256) int {
+	for i := 3; i >= 0; i-- {
+		if x[i] < y[i] {
+			return -1
+		}
+		if x[i] > y[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (x uint256) signedCmp(y uint256) int {
+	xNeg, yNeg := x.isNegative(), y.isNegative()
+	if xNeg != yNeg {
+		if xNeg {
+			return -1
+		}
+		return 1
+	}
+	return x.cmp(y)
+}
+
+func (x uint256) shl(n uint64) (z uint256) {
+	if n >= 256 {
+		return
+	}
+	limbs, shift := int(n/64), uint(n%64)
+	for i := 3; i >= limbs; i-- {
+		z[i] = x[i-limbs] << shift
+		if i-limbs > 0 && shift != 0 {
+			z[i] |= x[i-limbs-1] >> (64 - shift)
+		}
+	}
+	return
+}
+
+func (x uint256) shr(n uint64) (z uint256) {
+	if n >= 256 {
+		return
+	}
+	limbs, shift := int(n/64), uint(n%64)
+	for i := 0; i < 4-limbs; i++ {
+		z[i] = x[i+limbs] >> shift
+		if i+limbs < 3 && shift != 0 {
+			z[i] |= x[i+limbs+1] << (64 - shift)
+		}
+	}
+	return
+}
+
+func (x uint256) sar(n uint64) uint256 {
+	if !x.isNegative() {
+		return x.shr(n)
+	}
+	// for negative numbers: sar(x) = ^shr(^x)
+	return x.not().shr(n).not()
+}
+
+func (x uint256) not() uint256 {
+	return uint256{^x[0], ^x[1], ^x[2], ^x[3]}
+}
+
+// divRem returns the quotient and the remainder of x / y. `y` must not be
+// zero.
+func (x uint256) divRem(y uint256) (quot uint256, rem uint256) {
+	if x.cmp(y) < 0 {
+		return uint256{}, x
+	}
+	var q [8]uint64
+	rem = udivrem(q[:], x[:], y)
+	copy(quot[:], q[:4])
+	return
+}
+
+// signedDivRem returns the quotient and the remainder of a signed division.
+// The quotient is truncated toward zero and the remainder has the sign of
+// `x`. `y` must not be zero.
+func (x uint256) signedDivRem(y uint256) (quot uint256, rem uint256) {
+	quot, rem = x.abs().divRem(y.abs())
+	if x.isNegative() != y.isNegative() {
+		quot = quot.neg()
+	}
+	if x.isNegative() {
+		rem = rem.neg()
+	}
+	return
+}
+
+// addMod returns (x + y) mod m, where the addition is not truncated to 256
+// bits. `m` must not be zero.
+func (x uint256) addMod(y, m uint256) uint256 {
+	sum, carry := x.add(y)
+	u := [5]uint64{sum[0], sum[1], sum[2], sum[3], carry}
+	var q [8]uint64
+	return udivrem(q[:], u[:], m)
+}
+
+// mulMod returns (x * y) mod m, where the multiplication is not truncated
+// to 256 bits. `m` must not be zero.
+func (x uint256) mulMod(y, m uint256) uint256 {
+	p := x.mulFull(y)
+	var q [8]uint64
+	return udivrem(q[:], p[:], m)
+}
+
+// exp returns x^y mod 2^256.
+func (x uint256) exp(y uint256) uint256 {
+	z := uint256{1}
+	for i := 255 - y.leadingZeros(); i >= 0; i-- {
+		z = z.mul(z)
+		if y[i/64]>>(uint(i)%64)&1 == 1 {
+			z = z.mul(x)
+		}
+	}
+	return z
+}
+
+func (x uint256) leadingZeros() int {
+	for i := 3; i >= 0; i-- {
+		if x[i] != 0 {
+			return (3-i)*64 + bits.LeadingZeros64(x[i])
+		}
+	}
+	return 256
+}
+
+// udivrem divides `u` by `d` using the Knuth's algorithm D and returns the
+// remainder. The quotient is written into `quot`, which must have at least
+// len(u)-len(d)+1 limbs. `u` can have at most 8 limbs and `d` must not be
+// zero.
+func udivrem(quot, u []uint64, d uint256) (rem uint256) {
+	dLen := 0
+	for i := 3; i >= 0; i-- {
+		if d[i] != 0 {
+			dLen = i + 1
+			break
+		}
+	}
+	uLen := 0
+	for i := len(u) - 1; i >= 0; i-- {
+		if u[i] != 0 {
+			uLen = i + 1
+			break
+		}
+	}
+	if uLen < dLen {
+		copy(rem[:], u)
+		return
+	}
+
+	// normalizing, so the most significant bit of the divisor is set
+	shift := uint(bits.LeadingZeros64(d[dLen-1]))
+	var dnStorage [4]uint64
+	dn := dnStorage[:dLen]
+	for i := dLen - 1; i > 0; i-- {
+		dn[i] = d[i]<<shift | d[i-1]>>(64-shift)
+	}
+	dn[0] = d[0] << shift
+	var unStorage [9]uint64
+	un := unStorage[:uLen+1]
+	un[uLen] = u[uLen-1] >> (64 - shift)
+	for i := uLen - 1; i > 0; i-- {
+		un[i] = u[i]<<shift | u[i-1]>>(64-shift)
+	}
+	un[0] = u[0] << shift
+
+	if dLen == 1 {
+		r := un[uLen]
+		for j := uLen - 1; j >= 0; j-- {
+			quot[j], r = bits.Div64(r, un[j], dn[0])
+		}
+		rem[0] = r >> shift
+		return
+	}
+
+	dh, dl := dn[dLen-1], dn[dLen-2]
+	for j := uLen - dLen; j >= 0; j-- {
+		u2, u1, u0 := un[j+dLen], un[j+dLen-1], un[j+dLen-2]
+		var qhat uint64
+		if u2 >= dh {
+			qhat = ^uint64(0)
+		} else {
+			var rhat uint64
+			qhat, rhat = bits.Div64(u2, u1, dh)
+			ph, pl := bits.Mul64(qhat, dl)
+			if ph > rhat || ph == rhat && pl > u0 {
+				qhat--
+			}
+		}
+		borrow := subMul(un[j:j+dLen], dn, qhat)
+		un[j+dLen] = u2 - borrow
+		if u2 < borrow {
+			qhat--
+			un[j+dLen] += addTo(un[j:j+dLen], dn)
+		}
+		quot[j] = qhat
+	}
+
+	for i := 0; i < dLen-1; i++ {
+		rem[i] = un[i]>>shift | un[i+1]<<(64-shift)
+	}
+	rem[dLen-1] = un[dLen-1] >> shift
+	return
+}
+
+// subMul computes x -= y * multiplier and returns the borrow.
+func subMul(x, y []uint64, multiplier uint64) uint64 {
+	var borrow uint64
+	for i := range y {
+		s, carry1 := bits.Sub64(x[i], borrow, 0)
+		ph, pl := bits.Mul64(y[i], multiplier)
+		t, carry2 := bits.Sub64(s, pl, 0)
+		x[i] = t
+		borrow = ph + carry1 + carry2
+	}
+	return borrow
+}
+
+// addTo computes x += y and returns the carry.
+func addTo(x, y []uint64) uint64 {
+	var carry uint64
+	for i := range y {
+		x[i], carry = bits.Add64(x[i], y[i], carry)
+	}
+	return carry
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2021 aybehrouz <behrouz_ayati@yahoo.com>. This file is
+// part of the go-avm repository: the Go implementation of the Argennon
+// Virtual Machine (AVM).
+//
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the
+// Free Software Foundation, either version 3 of the License, or (at your
+// option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General
+// Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package avm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var two256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+func toBig(x uint256) *big.Int {
+	b := new(big.Int)
+	for i := 3; i >= 0; i-- {
+		b.Lsh(b, 64)
+		b.Or(b, new(big.Int).SetUint64(x[i]))
+	}
+	return b
+}
+
+func toSignedBig(x uint256) *big.Int {
+	b := toBig(x)
+	if x.isNegative() {
+		b.Sub(b, two256)
+	}
+	return b
+}
+
+func fromBig(b *big.Int) uint256 {
+	b = new(big.Int).Mod(b, two256)
+	var x uint256
+	for i := 0; i < 4; i++ {
+		x[i] = new(big.Int).And(b, new(big.Int).SetUint64(^uint64(0))).Uint64()
+		b.Rsh(b, 64)
+	}
+	return x
+}
+
+// randomUint256 returns random numbers with a random number of non-zero
+// limbs, so all the paths of the division algorithm are tested.
+func randomUint256(r *rand.Rand) uint256 {
+	var x uint256
+	for i := r.Intn(5) - 1; i >= 0; i-- {
+		switch r.Intn(4) {
+		case 0:
+			x[i] = ^uint64(0)
+		case 1:
+			x[i] = uint64(r.Intn(16))
+		default:
+			x[i] = r.Uint64()
+		}
+	}
+	return x
+}
+
+func TestUint256_Arithmetic(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		x, y, m := randomUint256(r), randomUint256(r), randomUint256(r)
+		bx, by, bm := toBig(x), toBig(y), toBig(m)
+
+		sum, _ := x.add(y)
+		assert.Equal(t, fromBig(new(big.Int).Add(bx, by)), sum)
+		assert.Equal(t, fromBig(new(big.Int).Sub(bx, by)), x.sub(y))
+		assert.Equal(t, fromBig(new(big.Int).Mul(bx, by)), x.mul(y))
+		assert.Equal(t, x.cmp(y), bx.Cmp(by))
+		assert.Equal(t, x.signedCmp(y), toSignedBig(x).Cmp(toSignedBig(y)))
+		n := uint64(r.Intn(300))
+		assert.Equal(t, fromBig(new(big.Int).Lsh(bx, uint(n))), x.shl(n))
+		assert.Equal(t, fromBig(new(big.Int).Rsh(bx, uint(n))), x.shr(n))
+		assert.Equal(t, fromBig(new(big.Int).Rsh(toSignedBig(x), uint(n))), x.sar(n))
+		if y.isZero() || m.isZero() {
+			continue
+		}
+		q, rem := x.divRem(y)
+		bq, brem := new(big.Int).QuoRem(bx, by, new(big.Int))
+		assert.Equal(t, fromBig(bq), q, "%v / %v", bx, by)
+		assert.Equal(t, fromBig(brem), rem, "%v %% %v", bx, by)
+		q, rem = x.signedDivRem(y)
+		bq, brem = new(big.Int).QuoRem(toSignedBig(x), toSignedBig(y), new(big.Int))
+		assert.Equal(t, fromBig(bq), q)
+		assert.Equal(t, fromBig(brem), rem)
+		assert.Equal(t, fromBig(new(big.Int).Mod(new(big.Int).Add(bx, by), bm)), x.addMod(y, m))
+		assert.Equal(t, fromBig(new(big.Int).Mod(new(big.Int).Mul(bx, by), bm)), x.mulMod(y, m))
+	}
+}
+
+func TestUint256_Exp(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		x, y := randomUint256(r), randomUint256(r)
+		assert.Equal(t, fromBig(new(big.Int).Exp(toBig(x), toBig(y), two256)), x.exp(y))
+	}
+}
+
+func TestUint256_Allocations(t *testing.T) {
+	x := uint256{1, 2, 3, 4}
+	y := uint256{5, 6, 7}
+	m := uint256{^uint64(0), 8}
+	allocs := testing.AllocsPerRun(100, func() {
+		x.divRem(y)
+		x.mulMod(y, m)
+		x.addMod(y, m)
+		x.exp(y)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
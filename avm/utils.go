@@ -19,12 +19,19 @@ package avm
 
 import (
 	"go-AVM/avm/binary"
+	"go-AVM/avm/memory"
 	"go-AVM/avm/prefix"
 )
 
 type dynamicArray struct {
 	content []byte
 	maxSize int64
+	// paidLen is the length that has been paid for. Growing the array beyond
+	// this length consumes gas.
+	paidLen int64
+	gas     *gasMeter
+	// limitError is raised when the array grows beyond maxSize
+	limitError ErrorCode
 }
 
 func (da *dynamicArray) shrinkTo(length int64) {
@@ -35,14 +42,17 @@ func (da *dynamicArray) ensureLen(length int64) *dynamicArray {
 	if length <= int64(len(da.content)) {
 		return da
 	}
+	if length > da.paidLen {
+		if length > da.maxSize {
+			panic(da.limitError)
+		}
+		da.gas.consumeMemory(length - da.paidLen)
+		da.paidLen = length
+	}
 	if length <= int64(cap(da.content)) {
 		da.content = da.content[:length]
 		return da
 	}
-	if length > da.maxSize {
-		panic(MemoryLimitExceeded)
-	}
-
 	b := make([]byte, min(da.maxSize, 2*length))
 	copy(b, da.content)
 	da.content = b[:length]
@@ -53,18 +63,91 @@ func (da *dynamicArray) length() int64 {
 	return int64(len(da.content))
 }
 
-func newOperandStack() *dynamicArray {
+func newOperandStack(gas *gasMeter) *dynamicArray {
 	return &dynamicArray{
-		content: make([]byte, 0, InitialOpStackSize),
-		maxSize: MaxOpStackSize,
+		content:    make([]byte, 0, InitialOpStackSize),
+		maxSize:    MaxOpStackSize,
+		paidLen:    InitialOpStackSize,
+		gas:        gas,
+		limitError: StackOverflow,
 	}
 }
 
-func newLocalFrame() *dynamicArray {
+func newLocalFrame(gas *gasMeter) *dynamicArray {
 	return &dynamicArray{
-		content: make([]byte, InitialLocalFrameSize),
-		maxSize: MaxLocalFrameSize,
+		content:    make([]byte, InitialLocalFrameSize),
+		maxSize:    MaxLocalFrameSize,
+		paidLen:    InitialLocalFrameSize,
+		gas:        gas,
+		limitError: LocalFrameOutOfRange,
+	}
+}
+
+// checkStackSlots makes sure that the operand stack contains at least `n`
+// 64-bit slots and returns the length of the operand stack.
+func (p *Processor) checkStackSlots(n int64) int64 {
+	top := p.current.operandStack.length()
+	if n*8 > top {
+		panic(StackUnderflow)
+	}
+	return top
+}
+
+func (p *Processor) swapSlots(i, j int64) {
+	content := p.current.operandStack.content
+	a := binary.ReadInt64(content, i)
+	binary.PutInt64(content, i, binary.ReadInt64(content, j))
+	binary.PutInt64(content, j, a)
+}
+
+// rollSlots moves the slot at the depth `depth` to the top of the stack.
+func (p *Processor) rollSlots(top int64, depth int64) {
+	content := p.current.operandStack.content
+	position := top - 8*(depth+1)
+	v := binary.ReadInt64(content, position)
+	copy(content[position:top-8], content[position+8:top])
+	binary.PutInt64(content, top-8, v)
+}
+
+// lfLoadN pushes `n` bytes of the local frame which start at `index` onto
+// the operand stack. The value is zero-extended to 64 bits.
+func (p *Processor) lfLoadN(index int64, n int64) {
+	frame := p.current.localFrame.content
+	if index < 0 || index > int64(len(frame))-n {
+		panic(LocalFrameOutOfRange)
+	}
+	var v int64
+	switch n {
+	case 1:
+		v = int64(frame[index])
+	case 2:
+		v = int64(binary.ReadUint16(frame, index))
+	case 4:
+		v = int64(binary.ReadUint32(frame, index))
+	default:
+		v = binary.ReadInt64(frame, index)
+	}
+	p.pushInt64(v)
+}
+
+// lfStoreN pops a value from the operand stack and stores its `n` least
+// significant bytes in the local frame at `index`. The local frame grows if
+// needed.
+func (p *Processor) lfStoreN(index int64, n int64) {
+	if index < 0 || index > MaxLocalFrameSize {
+		panic(LocalFrameOutOfRange)
+	}
+	top := p.checkStackSlots(1)
+	p.current.localFrame.ensureLen(index + n)
+	copy(p.current.localFrame.content[index:index+n], p.current.operandStack.content[top-8:top-8+n])
+	p.current.operandStack.shrinkTo(top - 8)
+}
+
+func boolToInt64(b bool) int64 {
+	if b {
+		return 1
 	}
+	return 0
 }
 
 func min(a, b int64) int64 {
@@ -75,28 +158,160 @@ func min(a, b int64) int64 {
 }
 
 func (p *Processor) popIdentifier64() prefix.Identifier64 {
-	top := p.current.operandStack.length()
+	top := p.checkStackSlots(1)
 	id := binary.ReadIdentifier64(p.current.operandStack.content, top-8)
 	p.current.operandStack.shrinkTo(top - 8)
 	return id
 }
 
+// checkConst makes sure that a constant of `n` bytes can be read from the
+// current pc of the method area.
+func (p *Processor) checkConst(n int64) {
+	if p.current.pc > p.methodArea.ChunkSize()-n {
+		panic(PcOutOfRange)
+	}
+}
+
+func (p *Processor) readConst8() byte {
+	p.checkConst(1)
+	c := p.methodArea.LoadByte(p.current.pc)
+	p.current.pc++
+	return c
+}
+
 func (p *Processor) readConst16() uint16 {
+	p.checkConst(2)
 	c := p.methodArea.LoadUint16(p.current.pc)
 	p.current.pc += 2
 	return c
 }
 
+func (p *Processor) readConst32() uint32 {
+	p.checkConst(4)
+	c := p.methodArea.LoadUint32(p.current.pc)
+	p.current.pc += 4
+	return c
+}
+
+// jumpC16 reads a 16-bit signed offset from the method area and adds it to
+// the pc when `cond` is true. The offset is relative to the end of the
+// instruction.
+func (p *Processor) jumpC16(cond bool) {
+	offset := int64(int16(p.readConst16()))
+	if cond {
+		p.current.pc += offset
+	}
+}
+
+// jumpC32 is the 32-bit version of jumpC16.
+func (p *Processor) jumpC32(cond bool) {
+	offset := int64(int32(p.readConst32()))
+	if cond {
+		p.current.pc += offset
+	}
+}
+
+func (p *Processor) popTwoInt64() (a int64, b int64) {
+	top := p.checkStackSlots(2)
+	a = binary.ReadInt64(p.current.operandStack.content, top-8)
+	b = binary.ReadInt64(p.current.operandStack.content, top-16)
+	p.current.operandStack.shrinkTo(top - 16)
+	return
+}
+
 func (p *Processor) peekInt64() (a int64, b int64, top int64) {
-	top = p.current.operandStack.length()
+	top = p.checkStackSlots(2)
 	a = binary.ReadInt64(p.current.operandStack.content, top-8)
 	b = binary.ReadInt64(p.current.operandStack.content, top-16)
 	return
 }
 
+func (p *Processor) peekUint64() (a uint64, b uint64, top int64) {
+	top = p.checkStackSlots(2)
+	a = uint64(binary.ReadInt64(p.current.operandStack.content, top-8))
+	b = uint64(binary.ReadInt64(p.current.operandStack.content, top-16))
+	return
+}
+
+// peekFloat64 is like peekInt64 for floats. It raises InvalidOperands if
+// any of the operands is NaN or infinity.
+func (p *Processor) peekFloat64() (a float64, b float64, top int64) {
+	top = p.checkStackSlots(2)
+	a = checkFloat(binary.ReadFloat64(p.current.operandStack.content, top-8))
+	b = checkFloat(binary.ReadFloat64(p.current.operandStack.content, top-16))
+	return
+}
+
+func (p *Processor) peekTopFloat64() (a float64, top int64) {
+	top = p.checkStackSlots(1)
+	a = checkFloat(binary.ReadFloat64(p.current.operandStack.content, top-8))
+	return
+}
+
+// peekUint256 is like peekInt64 for 256-bit integers. `a` is stored in the
+// 32 topmost bytes of the operand stack.
+func (p *Processor) peekUint256() (a uint256, b uint256, top int64) {
+	top = p.checkStackSlots(8)
+	a = binary.ReadUint256(p.current.operandStack.content, top-32)
+	b = binary.ReadUint256(p.current.operandStack.content, top-64)
+	return
+}
+
+func (p *Processor) peekTopUint256() (a uint256, top int64) {
+	top = p.checkStackSlots(4)
+	a = binary.ReadUint256(p.current.operandStack.content, top-32)
+	return
+}
+
+// putUint256Result replaces the two 256-bit operands of a binary instruction
+// with its 256-bit result.
+func (p *Processor) putUint256Result(r uint256, top int64) {
+	binary.PutUint256(p.current.operandStack.content, top-64, r)
+	p.current.operandStack.shrinkTo(top - 32)
+}
+
+// putUint256Bool replaces the two 256-bit operands of a binary instruction
+// with a 64-bit boolean.
+func (p *Processor) putUint256Bool(r bool, top int64) {
+	binary.PutInt64(p.current.operandStack.content, top-64, boolToInt64(r))
+	p.current.operandStack.shrinkTo(top - 56)
+}
+
+func (p *Processor) peekTopInt64() (a int64, top int64) {
+	top = p.checkStackSlots(1)
+	a = binary.ReadInt64(p.current.operandStack.content, top-8)
+	return
+}
+
 func (p *Processor) popInt64() int64 {
-	return 0
+	top := p.checkStackSlots(1)
+	v := binary.ReadInt64(p.current.operandStack.content, top-8)
+	p.current.operandStack.shrinkTo(top - 8)
+	return v
 }
 
 func (p *Processor) pushInt64(v int64) {
+	top := p.current.operandStack.length()
+	p.current.operandStack.ensureLen(top + 8)
+	binary.PutInt64(p.current.operandStack.content, top, v)
+}
+
+// popHeapLoadOffset pops an offset from the operand stack and makes sure
+// that `n` bytes can be loaded from that offset of the current heap chunk.
+func (p *Processor) popHeapLoadOffset(n int64) int64 {
+	offset := p.popInt64()
+	if offset < 0 || offset > p.heap.ChunkSize()-n {
+		panic(InvalidReference)
+	}
+	return offset
+}
+
+// popHeapStoreOffset pops an offset from the operand stack and makes sure
+// that `n` bytes can be stored at that offset of the current heap chunk.
+func (p *Processor) popHeapStoreOffset(n int64) int64 {
+	offset := p.popInt64()
+	if p.heap.ChunkSize() < 0 || offset < 0 || offset > memory.MaxChunkSize-n {
+		panic(InvalidReference)
+	}
+	return offset
 }